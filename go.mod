@@ -1,4 +1,4 @@
-module huemulator
+module github.com/ilesinge/huemulator
 
 go 1.21
 
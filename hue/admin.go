@@ -0,0 +1,103 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handleAdminAPI serves the /admin/ endpoints, which control the emulator
+// itself rather than emulate the bridge API
+func handleAdminAPI(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin"), "/")
+
+	switch {
+	case path == "linkbutton" && r.Method == "POST":
+		// Press the virtual link button
+		bridge.PressLinkButton()
+		writeJSON(w, map[string]interface{}{"linkbutton": true})
+	case path == "linkbutton" && r.Method == "GET":
+		writeJSON(w, map[string]interface{}{
+			"linkbutton": bridge.LinkButtonRemaining() > 0,
+			"remaining":  int(bridge.LinkButtonRemaining().Seconds()),
+		})
+	case path == "lights/new" && r.Method == "POST":
+		// Queue an undiscovered light for the next search
+		undiscovered, err := bridge.QueueLight()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"undiscovered": undiscovered})
+	case path == "lights/new" && r.Method == "GET":
+		writeJSON(w, map[string]interface{}{"undiscovered": bridge.UndiscoveredLights()})
+	case path == "clock" && r.Method == "GET":
+		writeClock(w, bridge)
+	case path == "clock" && r.Method == "PUT":
+		handleSetClock(w, r, bridge)
+	case path == "limits" && r.Method == "GET":
+		writeJSON(w, bridge.Limits())
+	case path == "limits" && r.Method == "PUT":
+		handleSetLimits(w, r, bridge)
+	case path == "sensors" || strings.HasPrefix(path, "sensors/"):
+		// Add sensors and simulate button presses, motion and other events
+		handleAdminSensors(w, r, path, bridge)
+	default:
+		http.Error(w, "Unknown admin endpoint", http.StatusNotFound)
+	}
+}
+
+// writeClock reports the virtual clock of the bridge
+func writeClock(w http.ResponseWriter, bridge *HueBridge) {
+	now := bridge.Now()
+	writeJSON(w, map[string]interface{}{
+		"utc":       now.UTC().Format(timeLayout),
+		"localtime": now.In(bridge.location()).Format(timeLayout),
+		"offset":    int(time.Until(now).Round(time.Second).Seconds()),
+	})
+}
+
+// handleSetClock handles PUT /admin/clock, which sets the virtual clock to
+// a "utc" or "localtime" time, moves it forward by an "advance" duration
+// such as "1h30m", or brings it back to real time with "realtime". The
+// schedules due in between run as the clock moves forward.
+func handleSetClock(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	var body struct {
+		UTC       string `json:"utc"`
+		LocalTime string `json:"localtime"`
+		Advance   string `json:"advance"`
+		RealTime  bool   `json:"realtime"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case body.RealTime:
+		bridge.ResetClock()
+	case body.UTC != "" || body.LocalTime != "":
+		value, loc := body.UTC, time.UTC
+		if body.LocalTime != "" {
+			value, loc = body.LocalTime, bridge.location()
+		}
+		t, err := time.ParseInLocation(timeLayout, value, loc)
+		if err != nil {
+			http.Error(w, "Invalid time, expected YYYY-MM-DDThh:mm:ss", http.StatusBadRequest)
+			return
+		}
+		bridge.SetClock(t)
+	case body.Advance != "":
+		d, err := time.ParseDuration(body.Advance)
+		if err != nil || d < 0 {
+			http.Error(w, "Invalid duration, expected e.g. 1h30m", http.StatusBadRequest)
+			return
+		}
+		bridge.AdvanceClock(d)
+	default:
+		http.Error(w, "Expected utc, localtime, advance or realtime", http.StatusBadRequest)
+		return
+	}
+	writeClock(w, bridge)
+}
@@ -0,0 +1,147 @@
+package hue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// linkButtonWindow is how long new users can register after the link
+// button has been pressed
+const linkButtonWindow = 30 * time.Second
+
+// WhitelistEntry is a user (application key) registered on the bridge
+type WhitelistEntry struct {
+	Name        string `json:"name"` // devicetype given when pairing
+	CreateDate  string `json:"create date"`
+	LastUseDate string `json:"last use date"`
+
+	clientKey string
+}
+
+// PressLinkButton presses the virtual link button, allowing new users to
+// register for the next 30 seconds.
+func (b *HueBridge) PressLinkButton() {
+	b.mu.Lock()
+	b.linkButtonPressed = time.Now()
+	b.mu.Unlock()
+}
+
+// SetLinkButtonAlwaysPressed makes the link button count as pressed at all
+// times, so that any application can pair without interaction.
+func (b *HueBridge) SetLinkButtonAlwaysPressed(pressed bool) {
+	b.mu.Lock()
+	b.linkButtonAlwaysPressed = pressed
+	b.mu.Unlock()
+}
+
+// LinkButtonRemaining returns how long pairing remains allowed, or 0 if the
+// link button is not pressed.
+func (b *HueBridge) LinkButtonRemaining() time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.linkButtonRemainingLocked()
+}
+
+// linkButtonRemainingLocked is LinkButtonRemaining with b.mu held
+func (b *HueBridge) linkButtonRemainingLocked() time.Duration {
+	if b.linkButtonAlwaysPressed {
+		return linkButtonWindow
+	}
+	if remaining := linkButtonWindow - time.Since(b.linkButtonPressed); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// AddUser whitelists username as if an application with the given
+// devicetype had paired with the bridge.
+func (b *HueBridge) AddUser(username, devicetype string) {
+	now := time.Now().UTC().Format(timeLayout)
+	b.mu.Lock()
+	b.whitelist[username] = &WhitelistEntry{
+		Name:        devicetype,
+		CreateDate:  now,
+		LastUseDate: now,
+	}
+	b.mu.Unlock()
+}
+
+// authorize reports whether username is whitelisted and records its use
+func (b *HueBridge) authorize(username string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, exists := b.whitelist[username]
+	if !exists {
+		return false
+	}
+	entry.LastUseDate = time.Now().UTC().Format(timeLayout)
+	return true
+}
+
+// registerUser creates a user if the link button is pressed. It returns
+// false otherwise.
+func (b *HueBridge) registerUser(devicetype string) (username, clientKey string, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.linkButtonRemainingLocked() == 0 {
+		return "", "", false
+	}
+	username = randomToken(20)
+	clientKey = strings.ToUpper(randomToken(16))
+	now := time.Now().UTC().Format(timeLayout)
+	b.whitelist[username] = &WhitelistEntry{
+		Name:        devicetype,
+		CreateDate:  now,
+		LastUseDate: now,
+		clientKey:   clientKey,
+	}
+	return username, clientKey, true
+}
+
+// randomToken returns n random bytes encoded as hex
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// handleCreateUser handles POST /api, the pairing request of applications
+func handleCreateUser(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	body, ok := decodeBody(w, r, "/")
+	if !ok {
+		return
+	}
+
+	var devicetype string
+	if raw, exists := body["devicetype"]; !exists || json.Unmarshal(raw, &devicetype) != nil || devicetype == "" {
+		writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/")})
+		return
+	}
+	if len(devicetype) > 40 {
+		writeJSON(w, []interface{}{newAPIError(errInvalidValue, "/devicetype", devicetype, "devicetype")})
+		return
+	}
+	var generateClientKey bool
+	if raw, exists := body["generateclientkey"]; exists && json.Unmarshal(raw, &generateClientKey) != nil {
+		writeJSON(w, []interface{}{newAPIError(errInvalidValue, "/generateclientkey", rawValue(raw), "generateclientkey")})
+		return
+	}
+
+	username, clientKey, ok := bridge.registerUser(devicetype)
+	if !ok {
+		writeJSON(w, []interface{}{newAPIError(errLinkButtonNotPressed, "")})
+		return
+	}
+
+	success := map[string]string{"username": username}
+	if generateClientKey {
+		success["clientkey"] = clientKey
+	}
+	writeJSON(w, []interface{}{map[string]interface{}{"success": success}})
+}
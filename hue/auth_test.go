@@ -0,0 +1,66 @@
+package hue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCreateUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		pressed bool
+		body    string
+		want    string
+	}{
+		{"link button not pressed", false, `{"devicetype":"app#test"}`, `"type":101`},
+		{"paired", true, `{"devicetype":"app#test"}`, `"username":`},
+		{"client key", true, `{"devicetype":"app#test","generateclientkey":true}`, `"clientkey":`},
+		{"missing devicetype", true, `{}`, `"type":5`},
+		{"devicetype too long", true, `{"devicetype":"` + strings.Repeat("a", 41) + `"}`, `"type":7`},
+		{"invalid generateclientkey", true, `{"devicetype":"app#test","generateclientkey":"yes"}`, `"type":7`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			if tt.pressed {
+				b.PressLinkButton()
+			}
+			rec := serve(b.Handler(), "POST", "/api", tt.body, "")
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("POST /api %s = %s, want %s", tt.body, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestPairedUser(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	h := b.Handler()
+	if rec := serve(h, "GET", "/api/newuser/lights", "", ""); !strings.Contains(rec.Body.String(), `"type":1,`) {
+		t.Errorf("unknown user = %s, want error 1", rec.Body)
+	}
+
+	b.PressLinkButton()
+	rec := serve(h, "POST", "/api", `{"devicetype":"app#test"}`, "")
+	var created []struct {
+		Success struct {
+			Username string `json:"username"`
+		} `json:"success"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || len(created) != 1 || created[0].Success.Username == "" {
+		t.Fatalf("POST /api = %s", rec.Body)
+	}
+	username := created[0].Success.Username
+	if rec := serve(h, "GET", "/api/"+username+"/lights", "", ""); strings.TrimSpace(rec.Body.String()) != "{}" {
+		t.Errorf("GET /lights as the new user = %s", rec.Body)
+	}
+	b.mu.RLock()
+	entry := b.whitelist[username]
+	b.mu.RUnlock()
+	if entry == nil || entry.Name != "app#test" {
+		t.Errorf("whitelist entry = %+v", entry)
+	}
+}
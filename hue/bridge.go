@@ -0,0 +1,325 @@
+// Package hue implements an emulated Philips Hue Bridge: the light model and
+// the v1 and v2 (CLIP) HTTP APIs. It has no GUI or network discovery
+// dependency, so it can be embedded in tests with httptest.NewTLSServer.
+package hue
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// timeLayout is the format of timestamps in the v1 API
+const timeLayout = "2006-01-02T15:04:05"
+
+// HueBridge represents the fake Hue Bridge
+type HueBridge struct {
+	lights map[string]*HueLight
+	// groups holds the v1 groups by ID, except the implicit group 0
+	groups map[string]*Group
+	// scenes holds the v1 scenes by ID
+	scenes map[string]*Scene
+	// schedules holds the v1 schedules by ID
+	schedules map[string]*Schedule
+	// rules holds the v1 rules by ID
+	rules map[string]*Rule
+	// sensors holds the v1 sensors by ID
+	sensors map[string]*Sensor
+	// resourcelinks holds the v1 resource links by ID
+	resourcelinks map[string]*ResourceLink
+	port          int
+	config        BridgeConfig
+	// limits are the maximum numbers of resources of each kind
+	limits Limits
+
+	// whitelist holds the registered users by username
+	whitelist map[string]*WhitelistEntry
+	// linkButtonPressed is when the virtual link button was last pressed
+	linkButtonPressed       time.Time
+	linkButtonAlwaysPressed bool
+
+	// undiscoveredLights is the number of lights queued for the next search
+	undiscoveredLights int
+	// scanStarted is when the last search for new lights started
+	scanStarted time.Time
+	// newLights holds the v1 IDs of the lights found by the last search
+	newLights map[string]bool
+
+	// OnLightCreated, when set, is called for every light added by
+	// CreateLight. The GUI uses it to open a window per light.
+	OnLightCreated func(id int, light *HueLight)
+
+	// mu protects the fields above
+	mu sync.RWMutex
+
+	// clock is the time of the bridge, which tests can move forward
+	clock virtualClock
+	// events sends the changes of resources to CLIP v2 event stream clients
+	events eventStream
+	// schedulerMu serializes the runs of due schedules
+	schedulerMu   sync.Mutex
+	schedulerOnce sync.Once
+	// stop is closed by Close to stop the scheduler
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	// ruleAddresses tracks the values used by rule conditions by address
+	ruleAddresses map[string]*addressState
+	// rulesHolding holds the IDs of the rules whose conditions held at the
+	// last evaluation, as rules only trigger when they start to hold
+	rulesHolding map[string]bool
+	// rulesMu protects the rule evaluation state above
+	rulesMu sync.Mutex
+}
+
+// NewHueBridge creates a new fake Hue Bridge
+func NewHueBridge(port int) *HueBridge {
+	return &HueBridge{
+		lights:        make(map[string]*HueLight),
+		groups:        make(map[string]*Group),
+		scenes:        make(map[string]*Scene),
+		schedules:     make(map[string]*Schedule),
+		rules:         make(map[string]*Rule),
+		sensors:       map[string]*Sensor{"1": daylightSensor()},
+		resourcelinks: make(map[string]*ResourceLink),
+		port:          port,
+		config:        defaultConfig(),
+		limits:        DefaultLimits(),
+		whitelist:     make(map[string]*WhitelistEntry),
+		newLights:     make(map[string]bool),
+
+		stop:          make(chan struct{}),
+		ruleAddresses: make(map[string]*addressState),
+		rulesHolding:  make(map[string]bool),
+	}
+}
+
+// Close stops the background work of the bridge: the scheduler running
+// schedules and rules, and the palette cycling of dynamic scenes. The bridge
+// still serves requests, but schedules no longer run in real time.
+func (b *HueBridge) Close() {
+	b.closeOnce.Do(func() {
+		close(b.stop)
+		b.mu.Lock()
+		for _, scene := range b.scenes {
+			scene.stopDynamicLocked()
+		}
+		b.mu.Unlock()
+	})
+}
+
+// CreateLight creates a new light and notifies OnLightCreated. It returns an
+// error if a light already has the ID or the light list of the bridge is
+// full.
+func (b *HueBridge) CreateLight(id int) (*HueLight, error) {
+	lightID := strconv.Itoa(id)
+	state := defaultLightState()
+	light := &HueLight{
+		ID:           uuid.New().String(), // Generate a unique ID for the light
+		Name:         fmt.Sprintf("Fake Hue Light %d", id),
+		Type:         "Extended color light",
+		ModelID:      "LCT016",
+		Manufacturer: "Philips",
+		SWVersion:    "1.65.11_r26581",
+		UniqueID:     fmt.Sprintf("00:17:88:01:00:bd:ab:%02x-0b", id),
+		Capabilities: capabilitiesForModel("LCT016"),
+		State:        &state,
+		v1ID:         lightID,
+		deviceID:     uuid.New().String(),
+	}
+	light.onUpdate = func(before LightState, beforeName string) {
+		b.publishLightChange(light, before, beforeName)
+	}
+
+	b.mu.Lock()
+	if _, exists := b.lights[lightID]; exists {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("light %d already exists", id)
+	}
+	if len(b.lights) >= b.limits.Lights {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("light list is full (%d lights)", b.limits.Lights)
+	}
+	b.lights[lightID] = light
+	b.mu.Unlock()
+	b.events.publish(eventAdd, convertToV2Device(light))
+	b.events.publish(eventAdd, convertToV2Light(light))
+
+	if b.OnLightCreated != nil {
+		b.OnLightCreated(id, light)
+	}
+
+	return light, nil
+}
+
+// defaultLightState returns the state of a light fresh out of the box: off,
+// at full brightness and a warm white
+func defaultLightState() LightState {
+	x, y := ctToXY(366)
+	hue, sat := xyToHueSat(x, y)
+	return LightState{
+		On:         false,
+		Brightness: 254,
+		Hue:        hue,
+		Saturation: sat,
+		XY:         [2]float64{x, y},
+		ColorTemp:  366,
+		ColorMode:  "ct",
+		Alert:      "none",
+		Effect:     "none",
+		Reachable:  true,
+	}
+}
+
+// Light returns the light with the given v1 ID
+func (b *HueBridge) Light(id string) (*HueLight, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	light, exists := b.lights[id]
+	return light, exists
+}
+
+// DeleteLight removes the light with the given v1 ID from the bridge, its
+// groups and scenes, and notifies its OnDelete listener. It returns false if there is
+// no such light.
+func (b *HueBridge) DeleteLight(id string) bool {
+	b.mu.Lock()
+	light, exists := b.lights[id]
+	delete(b.lights, id)
+	for groupID, group := range b.groups {
+		if containsLight(group, id) {
+			group.Lights = removeID(group.Lights, id)
+			b.publishGroupLocked(eventUpdate, groupID, group)
+		}
+	}
+	for sceneID, scene := range b.scenes {
+		n := len(scene.Lights)
+		scene.Lights = removeID(scene.Lights, id)
+		delete(scene.LightStates, id)
+		if len(scene.Lights) < n && b.sceneInV2Locked(scene) {
+			b.events.publish(eventUpdate, b.convertToV2SceneLocked(sceneID, scene))
+		}
+	}
+	if exists {
+		b.unlinkLocked("/lights/" + id)
+	}
+	b.mu.Unlock()
+	if !exists {
+		return false
+	}
+	b.events.publish(eventDelete, lightEventData(light))
+	b.events.publish(eventDelete, deviceEventData(light))
+
+	light.mu.RLock()
+	onDelete := light.onDelete
+	light.mu.RUnlock()
+	if onDelete != nil {
+		onDelete()
+	}
+	return true
+}
+
+// LightIDs returns the v1 IDs of all lights in numerical order
+func (b *HueBridge) LightIDs() []string {
+	b.mu.RLock()
+	ids := make([]string, 0, len(b.lights))
+	for id := range b.lights {
+		ids = append(ids, id)
+	}
+	b.mu.RUnlock()
+	sortIDs(ids)
+	return ids
+}
+
+// lightByAnyID finds a light by its v1 ID or by its v2 UUID
+func (b *HueBridge) lightByAnyID(id string) (*HueLight, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.lightByAnyIDLocked(id)
+}
+
+// lightByAnyIDLocked finds a light by its v1 ID or by its v2 UUID; b.mu must
+// be held
+func (b *HueBridge) lightByAnyIDLocked(id string) (*HueLight, bool) {
+	if light, exists := b.lights[id]; exists {
+		return light, true
+	}
+	for _, l := range b.lights {
+		if l.ID == id {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// Handler returns the HTTP handler serving the v1 and v2 APIs, the admin
+// API controlling the emulator and the UPnP description of the bridge.
+// Rules are evaluated after every request that may change the bridge.
+func (b *HueBridge) Handler() http.Handler {
+	mux := http.NewServeMux()
+	v1 := func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received API request: %s %s", r.Method, r.URL.Path)
+		handleHueAPI(w, r, b)
+		if r.Method != "GET" {
+			b.evaluateRules()
+		}
+	}
+	mux.HandleFunc("/api", v1)
+	mux.HandleFunc("/api/", v1)
+	mux.HandleFunc("/clip/v2/", func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received CLIP v2 API request: %s %s", r.Method, r.URL.Path)
+		handleHueV2API(w, r, b)
+		if r.Method != "GET" {
+			b.evaluateRules()
+		}
+	})
+	mux.HandleFunc("/admin/", func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received admin request: %s %s", r.Method, r.URL.Path)
+		handleAdminAPI(w, r, b)
+		if r.Method != "GET" {
+			b.evaluateRules()
+		}
+	})
+	mux.HandleFunc("/eventstream/clip/v2", func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received event stream request: %s %s", r.Method, r.URL.Path)
+		handleEventStream(w, r, b)
+	})
+	mux.HandleFunc("/description.xml", func(w http.ResponseWriter, r *http.Request) {
+		handleDescription(w, r, b)
+	})
+	return mux
+}
+
+// removeID returns ids without id, preserving the order of the others
+func removeID(ids []string, id string) []string {
+	kept := ids[:0]
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+// sortIDs sorts numeric v1 IDs by value, others lexicographically after them
+func sortIDs(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		a, errA := strconv.Atoi(ids[i])
+		b, errB := strconv.Atoi(ids[j])
+		switch {
+		case errA == nil && errB == nil:
+			return a < b
+		case errA == nil:
+			return true
+		case errB == nil:
+			return false
+		}
+		return ids[i] < ids[j]
+	})
+}
@@ -0,0 +1,144 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Limits are the maximum numbers of resources the bridge can hold, reported
+// by the v1 capabilities resource
+type Limits struct {
+	Lights  int `json:"lights"`
+	Sensors int `json:"sensors"`
+	Groups  int `json:"groups"`
+	Scenes  int `json:"scenes"`
+	// LightStates is the total number of light states stored in scenes
+	LightStates int `json:"lightstates"`
+	Schedules   int `json:"schedules"`
+	Rules       int `json:"rules"`
+	// Conditions and Actions are the totals over all rules
+	Conditions    int `json:"conditions"`
+	Actions       int `json:"actions"`
+	ResourceLinks int `json:"resourcelinks"`
+	// Streaming is the number of entertainment streams and Channels the
+	// number of lights each can drive
+	Streaming int `json:"streaming"`
+	Channels  int `json:"channels"`
+}
+
+// DefaultLimits returns the limits of a Hue Bridge v2
+func DefaultLimits() Limits {
+	return Limits{
+		Lights:        63,
+		Sensors:       250,
+		Groups:        64,
+		Scenes:        200,
+		LightStates:   12600,
+		Schedules:     100,
+		Rules:         250,
+		Conditions:    1500,
+		Actions:       1000,
+		ResourceLinks: 64,
+		Streaming:     1,
+		Channels:      20,
+	}
+}
+
+// Limits returns the resource limits of the bridge
+func (b *HueBridge) Limits() Limits {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.limits
+}
+
+// SetLimits changes the resource limits of the bridge. Resources beyond the
+// new limits are kept.
+func (b *HueBridge) SetLimits(limits Limits) {
+	b.mu.Lock()
+	b.limits = limits
+	b.mu.Unlock()
+}
+
+// lightStatesLocked returns the number of light states stored in scenes;
+// b.mu must be held
+func (b *HueBridge) lightStatesLocked() int {
+	n := 0
+	for _, scene := range b.scenes {
+		n += len(scene.LightStates)
+	}
+	return n
+}
+
+// ruleItemsLocked returns the numbers of conditions and actions of all
+// rules; b.mu must be held
+func (b *HueBridge) ruleItemsLocked() (int, int) {
+	conditions, actions := 0, 0
+	for _, rule := range b.rules {
+		conditions += len(rule.Conditions)
+		actions += len(rule.Actions)
+	}
+	return conditions, actions
+}
+
+// capacity is the usage of a kind of resource in the capabilities resource
+type capacity struct {
+	Available int `json:"available"`
+	Total     int `json:"total"`
+}
+
+func newCapacity(used, total int) capacity {
+	if used > total {
+		used = total
+	}
+	return capacity{Available: total - used, Total: total}
+}
+
+// capabilities builds the v1 capabilities resource from the current
+// resources of the bridge
+func (b *HueBridge) capabilities() map[string]interface{} {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	limits := b.limits
+	lightStates := b.lightStatesLocked()
+	conditions, actions := b.ruleItemsLocked()
+
+	return map[string]interface{}{
+		"lights":  newCapacity(len(b.lights), limits.Lights),
+		"sensors": newCapacity(len(b.sensors), limits.Sensors),
+		"groups":  newCapacity(len(b.groups), limits.Groups),
+		"scenes": map[string]interface{}{
+			"available":   newCapacity(len(b.scenes), limits.Scenes).Available,
+			"total":       limits.Scenes,
+			"lightstates": newCapacity(lightStates, limits.LightStates),
+		},
+		"schedules": newCapacity(len(b.schedules), limits.Schedules),
+		"rules": map[string]interface{}{
+			"available":  newCapacity(len(b.rules), limits.Rules).Available,
+			"total":      limits.Rules,
+			"conditions": newCapacity(conditions, limits.Conditions),
+			"actions":    newCapacity(actions, limits.Actions),
+		},
+		"resourcelinks": newCapacity(len(b.resourcelinks), limits.ResourceLinks),
+		"streaming": map[string]interface{}{
+			"available": limits.Streaming,
+			"total":     limits.Streaming,
+			"channels":  limits.Channels,
+		},
+	}
+}
+
+func handleGetCapabilities(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.capabilities())
+}
+
+// handleSetLimits handles PUT /admin/limits, which changes the given limits
+// and keeps the others
+func handleSetLimits(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	limits := bridge.Limits()
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	bridge.SetLimits(limits)
+	writeJSON(w, limits)
+}
@@ -0,0 +1,224 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#capabilities")
+	b.CreateLight(1)
+	b.CreateLight(2)
+	b.CreateLight(3)
+	h := b.Handler()
+
+	// Limits changed through the admin API keep the others
+	rec := serve(h, "PUT", "/admin/limits", `{"lights":10,"sensors":1}`, "")
+	if limits := b.Limits(); limits.Lights != 10 || limits.Sensors != 1 || limits.Groups != DefaultLimits().Groups {
+		t.Fatalf("PUT /admin/limits = %s", rec.Body)
+	}
+
+	rec = serve(h, "GET", "/api/owner/capabilities", "", "")
+	var capabilities struct {
+		Lights  capacity `json:"lights"`
+		Sensors capacity `json:"sensors"`
+		Scenes  struct {
+			Available   int      `json:"available"`
+			LightStates capacity `json:"lightstates"`
+		} `json:"scenes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &capabilities); err != nil {
+		t.Fatalf("GET /capabilities = %s", rec.Body)
+	}
+	if got := capabilities.Lights; got != (capacity{Available: 7, Total: 10}) {
+		t.Errorf("lights = %+v, want 7 of 10 available", got)
+	}
+	// The daylight sensor fills the sensors
+	if got := capabilities.Sensors; got != (capacity{Available: 0, Total: 1}) {
+		t.Errorf("sensors = %+v, want 0 of 1 available", got)
+	}
+	if got := capabilities.Scenes; got.Available != 200 || got.LightStates.Available != 12600 {
+		t.Errorf("scenes = %+v, want the default limits", got)
+	}
+
+	if rec := serve(h, "GET", "/api/newuser/capabilities", "", ""); !strings.Contains(rec.Body.String(), `"type":1,`) {
+		t.Errorf("capabilities of an unknown user = %s, want error 1", rec.Body)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	type request struct {
+		method, path, body string
+		v2                 bool
+	}
+	tests := []struct {
+		name   string
+		limits func(*Limits)
+		// setup creates resources up to the limit. "{room}" in the body of
+		// requests stands for the v2 ID of group 1 and "{scene}" in paths
+		// and responses for the ID of the scene created last.
+		setup   []request
+		request request
+		status  int
+		want    string
+	}{
+		{
+			name:    "v1 group",
+			limits:  func(l *Limits) { l.Groups = 1 },
+			setup:   []request{{method: "POST", path: "/api/owner/groups", body: `{"name":"A","lights":["1"]}`}},
+			request: request{method: "POST", path: "/api/owner/groups", body: `{"name":"B","lights":["2"]}`},
+			status:  http.StatusOK,
+			want:    `"type":301`,
+		},
+		{
+			name:    "v1 scene",
+			limits:  func(l *Limits) { l.Scenes = 0 },
+			request: request{method: "POST", path: "/api/owner/scenes", body: `{"name":"A","lights":["1"]}`},
+			status:  http.StatusOK,
+			want:    `"type":402`,
+		},
+		{
+			name:    "v1 scene lights",
+			limits:  func(l *Limits) { l.LightStates = 1 },
+			setup:   []request{{method: "POST", path: "/api/owner/scenes", body: `{"name":"A","lights":["1"]}`}},
+			request: request{method: "PUT", path: "/api/owner/scenes/{scene}", body: `{"lights":["1","2"]}`},
+			status:  http.StatusOK,
+			want:    `{"error":{"type":402,"address":"/scenes/{scene}/lights"`,
+		},
+		{
+			name:    "v1 resource link",
+			limits:  func(l *Limits) { l.ResourceLinks = 0 },
+			request: request{method: "POST", path: "/api/owner/resourcelinks", body: `{"name":"A","classid":1,"links":["/lights/1"]}`},
+			status:  http.StatusOK,
+			want:    `{"error":{"type":1101,"address":"/resourcelinks"`,
+		},
+		{
+			name:    "queued light",
+			limits:  func(l *Limits) { l.Lights = 2 },
+			request: request{method: "POST", path: "/admin/lights/new"},
+			status:  http.StatusInsufficientStorage,
+			want:    "light list is full (2 lights)",
+		},
+		{
+			name:    "v1 sensor",
+			limits:  func(l *Limits) { l.Sensors = 1 },
+			request: request{method: "POST", path: "/api/owner/sensors", body: `{"name":"Flag","type":"CLIPGenericFlag","modelid":"Flag","swversion":"1.0","uniqueid":"flag-1","manufacturername":"Test"}`},
+			status:  http.StatusOK,
+			want:    `"type":502`,
+		},
+		{
+			name:    "v1 schedule",
+			limits:  func(l *Limits) { l.Schedules = 0 },
+			request: request{method: "POST", path: "/api/owner/schedules", body: `{"localtime":"PT00:01:00","command":{"address":"/api/owner/lights/1/state","method":"PUT","body":{"on":true}}}`},
+			status:  http.StatusOK,
+			want:    `"type":701`,
+		},
+		{
+			name:   "v1 rule actions",
+			limits: func(l *Limits) { l.Actions = 1 },
+			request: request{method: "POST", path: "/api/owner/rules",
+				body: `{"conditions":[{"address":"/lights/1/state/on","operator":"dx"}],"actions":[` +
+					`{"address":"/lights/1/state","method":"PUT","body":{"on":true}},` +
+					`{"address":"/lights/2/state","method":"PUT","body":{"on":true}}]}`},
+			status: http.StatusOK,
+			want:   `"type":601`,
+		},
+		{
+			name:    "v2 room",
+			limits:  func(l *Limits) { l.Groups = 1 },
+			setup:   []request{{method: "POST", path: "/api/owner/groups", body: `{"name":"A","lights":["1"]}`}},
+			request: request{method: "POST", path: "/clip/v2/resource/room", body: `{"metadata":{"name":"B"}}`, v2: true},
+			status:  http.StatusInsufficientStorage,
+			want:    "cannot create room: the bridge holds 1 at most",
+		},
+		{
+			name:    "v2 zone",
+			limits:  func(l *Limits) { l.Groups = 0 },
+			request: request{method: "POST", path: "/clip/v2/resource/zone", body: `{"metadata":{"name":"B"}}`, v2: true},
+			status:  http.StatusInsufficientStorage,
+			want:    "cannot create zone: the bridge holds 0 at most",
+		},
+		{
+			name:   "v2 scene",
+			limits: func(l *Limits) { l.Scenes = 0 },
+			request: request{method: "POST", path: "/clip/v2/resource/scene", v2: true,
+				body: `{"metadata":{"name":"A"},"group":{"rid":"{room}","rtype":"room"},"actions":[]}`},
+			status: http.StatusInsufficientStorage,
+			want:   "cannot create scene: the bridge holds 0 at most",
+		},
+		{
+			name:   "v2 scene light states",
+			limits: func(l *Limits) { l.LightStates = 1 },
+			setup:  []request{{method: "POST", path: "/api/owner/groups", body: `{"name":"A","type":"Room","lights":["1","2"]}`}},
+			request: request{method: "POST", path: "/clip/v2/resource/scene", v2: true,
+				body: `{"metadata":{"name":"A"},"group":{"rid":"{room}","rtype":"room"},"actions":[` +
+					`{"target":{"rid":"1","rtype":"light"},"action":{"on":{"on":true}}},` +
+					`{"target":{"rid":"2","rtype":"light"},"action":{"on":{"on":true}}}]}`},
+			status: http.StatusInsufficientStorage,
+			want:   "cannot create scene light state: the bridge holds 1 at most",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#limits")
+			b.CreateLight(1)
+			b.CreateLight(2)
+			h := b.Handler()
+			scene := ""
+			send := func(r request) (int, string) {
+				key := ""
+				if r.v2 {
+					key = "owner"
+				}
+				body := r.body
+				b.mu.RLock()
+				if group, exists := b.groups["1"]; exists {
+					body = strings.ReplaceAll(body, "{room}", group.v2ID)
+				}
+				b.mu.RUnlock()
+				rec := serve(h, r.method, strings.ReplaceAll(r.path, "{scene}", scene), body, key)
+				return rec.Code, rec.Body.String()
+			}
+			for _, r := range tt.setup {
+				status, body := send(r)
+				if status != http.StatusOK || strings.Contains(body, "error") {
+					t.Fatalf("%s %s = %d %s", r.method, r.path, status, body)
+				}
+				var created []struct {
+					Success struct {
+						ID string `json:"id"`
+					} `json:"success"`
+				}
+				if json.Unmarshal([]byte(body), &created) == nil && len(created) == 1 {
+					scene = created[0].Success.ID
+				}
+			}
+			limits := b.Limits()
+			tt.limits(&limits)
+			b.SetLimits(limits)
+
+			status, body := send(tt.request)
+			want := strings.ReplaceAll(tt.want, "{scene}", scene)
+			if status != tt.status || !strings.Contains(body, want) {
+				t.Errorf("%s %s = %d %s, want %d with %s", tt.request.method, tt.request.path, status, body, tt.status, want)
+			}
+		})
+	}
+
+	// Lights beyond the limit are not created
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.SetLimits(Limits{Lights: 1})
+	if _, err := b.CreateLight(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.CreateLight(2); err == nil || err.Error() != "light list is full (1 lights)" {
+		t.Errorf("CreateLight beyond the limit = %v", err)
+	}
+}
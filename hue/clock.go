@@ -0,0 +1,80 @@
+package hue
+
+import (
+	"sync"
+	"time"
+)
+
+// virtualClock is the time of the bridge as seen by schedules and reported
+// in its configuration. It follows real time, shifted by an offset that can
+// be changed to test time-based features without waiting.
+type virtualClock struct {
+	offset time.Duration
+	mu     sync.Mutex
+}
+
+func (c *virtualClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Add(c.offset)
+}
+
+func (c *virtualClock) set(t time.Time) {
+	c.mu.Lock()
+	c.offset = time.Until(t)
+	c.mu.Unlock()
+}
+
+func (c *virtualClock) reset() {
+	c.mu.Lock()
+	c.offset = 0
+	c.mu.Unlock()
+}
+
+// Now returns the current time of the bridge, which is real time unless the
+// clock has been changed with SetClock or AdvanceClock.
+func (b *HueBridge) Now() time.Time {
+	return b.clock.now()
+}
+
+// SetClock sets the clock of the bridge to t, after which it keeps running
+// in real time. Moving the clock forward runs every schedule due in between,
+// in order, as if the time had passed.
+func (b *HueBridge) SetClock(t time.Time) {
+	if t.Before(b.Now()) {
+		b.schedulerMu.Lock()
+		b.clock.set(t)
+		b.rescheduleAll()
+		b.schedulerMu.Unlock()
+		return
+	}
+	b.runSchedulesUntil(t)
+}
+
+// AdvanceClock moves the clock of the bridge forward by d, running the
+// schedules due in between.
+func (b *HueBridge) AdvanceClock(d time.Duration) {
+	b.SetClock(b.Now().Add(d))
+}
+
+// ResetClock brings the clock of the bridge back to real time
+func (b *HueBridge) ResetClock() {
+	if b.Now().Before(time.Now()) {
+		b.runSchedulesUntil(time.Now())
+	}
+	b.schedulerMu.Lock()
+	b.clock.reset()
+	b.rescheduleAll()
+	b.schedulerMu.Unlock()
+}
+
+// location returns the timezone of the bridge
+func (b *HueBridge) location() *time.Location {
+	b.mu.RLock()
+	timezone := b.config.Timezone
+	b.mu.RUnlock()
+	if loc, err := time.LoadLocation(timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
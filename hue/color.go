@@ -0,0 +1,272 @@
+package hue
+
+import (
+	"math"
+	"strings"
+)
+
+// xyPoint is a chromaticity coordinate in the CIE 1931 color space
+type xyPoint struct {
+	X, Y float64
+}
+
+// gamut is the triangle of colors a light can reproduce
+type gamut struct {
+	Red, Green, Blue xyPoint
+}
+
+// Color gamuts of the Philips Hue product range
+var (
+	gamutA = gamut{Red: xyPoint{0.704, 0.296}, Green: xyPoint{0.2151, 0.7106}, Blue: xyPoint{0.138, 0.08}}
+	gamutB = gamut{Red: xyPoint{0.675, 0.322}, Green: xyPoint{0.409, 0.518}, Blue: xyPoint{0.167, 0.04}}
+	gamutC = gamut{Red: xyPoint{0.6915, 0.3083}, Green: xyPoint{0.17, 0.7}, Blue: xyPoint{0.1532, 0.0475}}
+)
+
+// gamutForModel returns the color gamut and its letter for a light model ID.
+// Unknown models are assumed to be recent gamut C lights.
+func gamutForModel(modelID string) (gamut, string) {
+	switch modelID {
+	case "LLC001", "LLC005", "LLC006", "LLC007", "LLC010", "LLC011",
+		"LLC012", "LLC013", "LLC014", "LST001":
+		return gamutA, "A"
+	case "LCT001", "LCT002", "LCT003", "LCT007", "LLM001":
+		return gamutB, "B"
+	}
+	if strings.HasPrefix(modelID, "LLC") && modelID != "LLC020" {
+		return gamutA, "A"
+	}
+	return gamutC, "C"
+}
+
+// contains reports whether p lies inside the gamut triangle
+func (g gamut) contains(p xyPoint) bool {
+	d1 := cross(g.Red, g.Green, p)
+	d2 := cross(g.Green, g.Blue, p)
+	d3 := cross(g.Blue, g.Red, p)
+	hasNeg := d1 < 0 || d2 < 0 || d3 < 0
+	hasPos := d1 > 0 || d2 > 0 || d3 > 0
+	return !(hasNeg && hasPos)
+}
+
+// clamp returns p if it is inside the gamut, otherwise the closest point on
+// the edges of the gamut triangle, as the bridge does for unreachable colors.
+func (g gamut) clamp(p xyPoint) xyPoint {
+	if g.contains(p) {
+		return p
+	}
+	best := closestOnSegment(g.Red, g.Green, p)
+	for _, c := range []xyPoint{closestOnSegment(g.Green, g.Blue, p), closestOnSegment(g.Blue, g.Red, p)} {
+		if distance(c, p) < distance(best, p) {
+			best = c
+		}
+	}
+	return best
+}
+
+func cross(a, b, p xyPoint) float64 {
+	return (b.X-a.X)*(p.Y-a.Y) - (b.Y-a.Y)*(p.X-a.X)
+}
+
+func closestOnSegment(a, b, p xyPoint) xyPoint {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return xyPoint{a.X + t*dx, a.Y + t*dy}
+}
+
+func distance(a, b xyPoint) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+// RGB returns the color the light emits in the given state, ignoring the
+// on/off flag.
+func (s LightState) RGB() (r, g, b uint8) {
+	switch s.ColorMode {
+	case "hs":
+		return hsvToRGB(s.Hue, s.Saturation, s.Brightness)
+	case "xy":
+		return xyToRGB(s.XY[0], s.XY[1], s.Brightness)
+	}
+	x, y := ctToXY(s.ColorTemp)
+	return xyToRGB(x, y, s.Brightness)
+}
+
+// xyToRGB converts a CIE xy coordinate and brightness to gamma corrected
+// sRGB, using the wide gamut conversion recommended by Philips.
+func xyToRGB(x, y float64, bri uint8) (r, g, b uint8) {
+	rf, gf, bf := xyToLinearRGB(x, y)
+	v := float64(bri) / 254.0
+	return toByte(gammaCompress(rf) * v), toByte(gammaCompress(gf) * v), toByte(gammaCompress(bf) * v)
+}
+
+// xyToLinearRGB converts a CIE xy coordinate to linear RGB at full
+// brightness, scaled so that the largest component is 1.
+func xyToLinearRGB(x, y float64) (r, g, b float64) {
+	if y <= 0 {
+		return 0, 0, 0
+	}
+	z := 1.0 - x - y
+	bigY := 1.0
+	bigX := (bigY / y) * x
+	bigZ := (bigY / y) * z
+
+	r = bigX*1.656492 - bigY*0.354851 - bigZ*0.255038
+	g = -bigX*0.707196 + bigY*1.655397 + bigZ*0.036152
+	b = bigX*0.051713 - bigY*0.121364 + bigZ*1.011530
+
+	r, g, b = math.Max(r, 0), math.Max(g, 0), math.Max(b, 0)
+	if m := math.Max(r, math.Max(g, b)); m > 0 {
+		r, g, b = r/m, g/m, b/m
+	}
+	return
+}
+
+// rgbToXY converts linear RGB components (0-1) to a CIE xy coordinate
+func rgbToXY(r, g, b float64) (float64, float64) {
+	bigX := r*0.664511 + g*0.154324 + b*0.162028
+	bigY := r*0.283881 + g*0.668433 + b*0.047685
+	bigZ := r*0.000088 + g*0.072310 + b*0.986039
+	sum := bigX + bigY + bigZ
+	if sum == 0 {
+		// Black has no chromaticity; report the white point
+		return 0.3227, 0.329
+	}
+	return bigX / sum, bigY / sum
+}
+
+// hueSatToXY converts a hue/saturation pair to a CIE xy coordinate clamped
+// to the gamut.
+func hueSatToXY(hue uint16, sat uint8, g gamut) (float64, float64) {
+	r, gr, b := hsvToRGBFloat(float64(hue)/65535.0*360.0, float64(sat)/254.0, 1)
+	x, y := rgbToXY(gammaExpand(r), gammaExpand(gr), gammaExpand(b))
+	p := g.clamp(xyPoint{x, y})
+	return round4(p.X), round4(p.Y)
+}
+
+// xyToHueSat converts a CIE xy coordinate to the hue/saturation pair the
+// bridge reports alongside it.
+func xyToHueSat(x, y float64) (uint16, uint8) {
+	r, g, b := xyToLinearRGB(x, y)
+	r, g, b = gammaCompress(r), gammaCompress(g), gammaCompress(b)
+
+	hi := math.Max(r, math.Max(g, b))
+	lo := math.Min(r, math.Min(g, b))
+	delta := hi - lo
+
+	var h float64
+	switch {
+	case delta == 0:
+		h = 0
+	case hi == r:
+		h = 60 * mod((g-b)/delta, 6)
+	case hi == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	var s float64
+	if hi > 0 {
+		s = delta / hi
+	}
+	return uint16(math.Round(h / 360.0 * 65535.0)), uint8(math.Round(s * 254.0))
+}
+
+// ctToXY converts a color temperature in mireds to the CIE xy coordinate of
+// the matching point on the Planckian locus.
+func ctToXY(mired uint16) (float64, float64) {
+	if mired == 0 {
+		mired = 1
+	}
+	t := 1e6 / float64(mired)
+	t = math.Max(1667, math.Min(25000, t))
+
+	var x float64
+	if t <= 4000 {
+		x = -0.2661239e9/(t*t*t) - 0.2343589e6/(t*t) + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/(t*t*t) + 2.1070379e6/(t*t) + 0.2226347e3/t + 0.240390
+	}
+
+	var y float64
+	switch {
+	case t <= 2222:
+		y = -1.1063814*x*x*x - 1.34811020*x*x + 2.18555832*x - 0.20219683
+	case t <= 4000:
+		y = -0.9549476*x*x*x - 1.37418593*x*x + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x*x*x - 5.87338670*x*x + 3.75112997*x - 0.37001483
+	}
+	return round4(x), round4(y)
+}
+
+// hsvToRGB converts HSV values to RGB
+func hsvToRGB(hue uint16, sat, val uint8) (r, g, b uint8) {
+	h := float64(hue) / 65535.0 * 360.0
+	s := float64(sat) / 254.0
+	v := float64(val) / 254.0
+
+	r1, g1, b1 := hsvToRGBFloat(h, s, v)
+	return toByte(r1), toByte(g1), toByte(b1)
+}
+
+// hsvToRGBFloat converts HSV (h in degrees, s and v in 0-1) to RGB in 0-1
+func hsvToRGBFloat(h, s, v float64) (r, g, b float64) {
+	c := v * s
+	x := c * (1 - abs(mod(h/60.0, 2)-1))
+	m := v - c
+
+	var r1, g1, b1 float64
+	if h >= 0 && h < 60 {
+		r1, g1, b1 = c, x, 0
+	} else if h >= 60 && h < 120 {
+		r1, g1, b1 = x, c, 0
+	} else if h >= 120 && h < 180 {
+		r1, g1, b1 = 0, c, x
+	} else if h >= 180 && h < 240 {
+		r1, g1, b1 = 0, x, c
+	} else if h >= 240 && h < 300 {
+		r1, g1, b1 = x, 0, c
+	} else {
+		r1, g1, b1 = c, 0, x
+	}
+	return r1 + m, g1 + m, b1 + m
+}
+
+// gammaExpand converts an sRGB component to linear light
+func gammaExpand(v float64) float64 {
+	if v > 0.04045 {
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return v / 12.92
+}
+
+// gammaCompress converts a linear light component to sRGB
+func gammaCompress(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1.0/2.4) - 0.055
+}
+
+func toByte(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+// round4 rounds to the 4 decimals the bridge reports xy coordinates with
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func mod(x, y float64) float64 {
+	return x - y*float64(int(x/y))
+}
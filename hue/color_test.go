@@ -0,0 +1,152 @@
+package hue
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGamutClamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		gamut gamut
+		p     xyPoint
+		want  xyPoint
+	}{
+		{"inside", gamutC, xyPoint{0.3227, 0.329}, xyPoint{0.3227, 0.329}},
+		{"corner", gamutB, xyPoint{0.675, 0.322}, xyPoint{0.675, 0.322}},
+		{"beyond red", gamutB, xyPoint{0.8, 0.3}, gamutB.Red},
+		{"beyond green", gamutA, xyPoint{0.3, 0.9}, gamutA.Green},
+		{"beyond blue", gamutC, xyPoint{0, 0}, gamutC.Blue},
+		{"beyond red-green edge", gamutC, xyPoint{0.5, 0.5}, closestOnSegment(gamutC.Red, gamutC.Green, xyPoint{0.5, 0.5})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.gamut.clamp(tt.p)
+			if distance(got, tt.want) > 1e-9 {
+				t.Errorf("clamp(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+			if !tt.gamut.contains(got) && !onEdge(tt.gamut, got) {
+				t.Errorf("clamp(%v) = %v, outside the gamut", tt.p, got)
+			}
+		})
+	}
+}
+
+// onEdge reports whether p lies on an edge of the gamut triangle
+func onEdge(g gamut, p xyPoint) bool {
+	for _, edge := range [][2]xyPoint{{g.Red, g.Green}, {g.Green, g.Blue}, {g.Blue, g.Red}} {
+		if distance(closestOnSegment(edge[0], edge[1], p), p) < 1e-9 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHueSatToXY(t *testing.T) {
+	tests := []struct {
+		name  string
+		hue   uint16
+		sat   uint8
+		gamut gamut
+		x, y  float64
+	}{
+		{"red in gamut A", 0, 254, gamutA, 0.7004, 0.2991},
+		{"red clamped to gamut B", 0, 254, gamutB, 0.675, 0.322},
+		{"red clamped to gamut C", 0, 254, gamutC, 0.6915, 0.3083},
+		{"green clamped to gamut C", 21845, 254, gamutC, 0.17, 0.7},
+		{"blue clamped to gamut B", 43690, 254, gamutB, 0.167, 0.04},
+		{"white", 0, 0, gamutC, 0.3227, 0.329},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y := hueSatToXY(tt.hue, tt.sat, tt.gamut)
+			if x != tt.x || y != tt.y {
+				t.Errorf("hueSatToXY(%d, %d) = %v, %v, want %v, %v", tt.hue, tt.sat, x, y, tt.x, tt.y)
+			}
+		})
+	}
+}
+
+func TestXYToHueSat(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y float64
+		hue  uint16
+		sat  uint8
+	}{
+		{"red", 0.7, 0.3, 212, 254},
+		{"gamut B red", 0.675, 0.322, 2857, 254},
+		{"gamut B blue", 0.167, 0.04, 46999, 254},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hue, sat := xyToHueSat(tt.x, tt.y)
+			if hue != tt.hue || sat != tt.sat {
+				t.Errorf("xyToHueSat(%v, %v) = %d, %d, want %d, %d", tt.x, tt.y, hue, sat, tt.hue, tt.sat)
+			}
+		})
+	}
+
+	// The white point has no saturation, whatever its hue
+	if _, sat := xyToHueSat(0.3227, 0.329); sat != 0 {
+		t.Errorf("xyToHueSat of the white point has saturation %d, want 0", sat)
+	}
+}
+
+func TestCTToXY(t *testing.T) {
+	tests := []struct {
+		mired uint16
+		x, y  float64
+	}{
+		{153, 0.3129, 0.3231},
+		{366, 0.4567, 0.4101},
+		{500, 0.5269, 0.4133},
+	}
+	for _, tt := range tests {
+		x, y := ctToXY(tt.mired)
+		if x != tt.x || y != tt.y {
+			t.Errorf("ctToXY(%d) = %v, %v, want %v, %v", tt.mired, x, y, tt.x, tt.y)
+		}
+	}
+
+	// Out of range temperatures are clamped to the ends of the locus
+	x0, y0 := ctToXY(0)
+	x1, y1 := ctToXY(40)
+	if x0 != x1 || y0 != y1 {
+		t.Errorf("ctToXY(0) = %v, %v, want ctToXY(40) = %v, %v", x0, y0, x1, y1)
+	}
+}
+
+func TestLightColorUpdate(t *testing.T) {
+	xy := func(x, y float64) *[2]float64 { return &[2]float64{x, y} }
+	ct := func(v uint16) *uint16 { return &v }
+	tests := []struct {
+		name      string
+		model     string
+		update    StateUpdate
+		xy        [2]float64
+		ct        uint16
+		colorMode string
+	}{
+		{"xy in gamut", "LCT016", StateUpdate{XY: xy(0.4, 0.4)}, [2]float64{0.4, 0.4}, 366, "xy"},
+		{"xy clamped to gamut B", "LCT001", StateUpdate{XY: xy(0.8, 0.3)}, [2]float64{0.675, 0.322}, 366, "xy"},
+		{"xy clamped to the unit square", "LCT016", StateUpdate{XY: xy(0.3, 0.9)}, [2]float64{0.17, 0.7}, 366, "xy"},
+		{"ct", "LCT016", StateUpdate{ColorTemp: ct(153)}, [2]float64{0.3129, 0.3231}, 153, "ct"},
+		{"ct clamped to the light", "LTW001", StateUpdate{ColorTemp: ct(500)}, [2]float64{0.5052, 0.4152}, 454, "ct"},
+		{"ct ignored without ct support", "LLC010", StateUpdate{ColorTemp: ct(153)}, [2]float64{0.4567, 0.4101}, 366, "ct"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := defaultLightState()
+			light := &HueLight{ModelID: tt.model, Capabilities: capabilitiesForModel(tt.model), State: &state}
+			light.updateLightState(tt.update)
+			got := light.Snapshot()
+			if math.Abs(got.XY[0]-tt.xy[0]) > 1e-4 || math.Abs(got.XY[1]-tt.xy[1]) > 1e-4 {
+				t.Errorf("xy = %v, want %v", got.XY, tt.xy)
+			}
+			if got.ColorTemp != tt.ct || got.ColorMode != tt.colorMode {
+				t.Errorf("ct = %d in mode %q, want %d in mode %q", got.ColorTemp, got.ColorMode, tt.ct, tt.colorMode)
+			}
+		})
+	}
+}
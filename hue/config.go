@@ -0,0 +1,315 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezones must resolve on systems without a tz database
+
+	"github.com/google/uuid"
+)
+
+// Versions reported by the emulated bridge, matching the mDNS advertisement
+const (
+	bridgeModelID    = "BSB002"
+	bridgeSWVersion  = "1965111030"
+	bridgeAPIVersion = "1.65.0"
+	datastoreVersion = "126"
+)
+
+// BridgeConfig holds the settings of the bridge, as reported by the v1
+// /config resource
+type BridgeConfig struct {
+	Name             string                    `json:"name"`
+	ZigbeeChannel    int                       `json:"zigbeechannel"`
+	BridgeID         string                    `json:"bridgeid"`
+	MAC              string                    `json:"mac"`
+	DHCP             bool                      `json:"dhcp"`
+	IPAddress        string                    `json:"ipaddress"`
+	Netmask          string                    `json:"netmask"`
+	Gateway          string                    `json:"gateway"`
+	ProxyAddress     string                    `json:"proxyaddress"`
+	ProxyPort        int                       `json:"proxyport"`
+	UTC              string                    `json:"UTC"`
+	LocalTime        string                    `json:"localtime"`
+	Timezone         string                    `json:"timezone"`
+	ModelID          string                    `json:"modelid"`
+	DatastoreVersion string                    `json:"datastoreversion"`
+	SWVersion        string                    `json:"swversion"`
+	APIVersion       string                    `json:"apiversion"`
+	LinkButton       bool                      `json:"linkbutton"`
+	PortalServices   bool                      `json:"portalservices"`
+	PortalConnection string                    `json:"portalconnection"`
+	FactoryNew       bool                      `json:"factorynew"`
+	ReplacesBridgeID *string                   `json:"replacesbridgeid"`
+	StarterKitID     string                    `json:"starterkitid"`
+	Whitelist        map[string]WhitelistEntry `json:"whitelist"`
+}
+
+// shortConfig is the part of the configuration readable without a user
+type shortConfig struct {
+	Name             string  `json:"name"`
+	DatastoreVersion string  `json:"datastoreversion"`
+	SWVersion        string  `json:"swversion"`
+	APIVersion       string  `json:"apiversion"`
+	MAC              string  `json:"mac"`
+	BridgeID         string  `json:"bridgeid"`
+	FactoryNew       bool    `json:"factorynew"`
+	ReplacesBridgeID *string `json:"replacesbridgeid"`
+	ModelID          string  `json:"modelid"`
+	StarterKitID     string  `json:"starterkitid"`
+}
+
+// defaultConfig returns the configuration of a freshly set up bridge
+func defaultConfig() BridgeConfig {
+	bridgeID, mac := bridgeIdentity()
+	return BridgeConfig{
+		Name:             "Philips hue",
+		ZigbeeChannel:    25,
+		BridgeID:         bridgeID,
+		MAC:              mac,
+		DHCP:             true,
+		Netmask:          "255.255.255.0",
+		ProxyAddress:     "none",
+		Timezone:         "UTC",
+		ModelID:          bridgeModelID,
+		DatastoreVersion: datastoreVersion,
+		SWVersion:        bridgeSWVersion,
+		APIVersion:       bridgeAPIVersion,
+		PortalConnection: "disconnected",
+	}
+}
+
+// bridgeIdentity derives a stable bridge ID and MAC address from the first
+// MAC-48 network interface. The bridge ID inserts FFFE in the middle of the
+// MAC to form an EUI-64-like identifier. Falls back to random values.
+func bridgeIdentity() (bridgeID, mac string) {
+	hw := net.HardwareAddr(nil)
+	ifs, err := net.Interfaces()
+	if err == nil {
+		for _, inf := range ifs {
+			if len(inf.HardwareAddr) == 6 { // MAC-48
+				hw = inf.HardwareAddr
+				break
+			}
+		}
+	}
+	if hw == nil {
+		// Fallback to UUID-based
+		u := uuid.New()
+		hw = net.HardwareAddr(u[:6])
+	}
+	// Insert FF FE after the first 3 bytes
+	bridgeID = fmt.Sprintf("%02X%02X%02XFFFE%02X%02X%02X", hw[0], hw[1], hw[2], hw[3], hw[4], hw[5])
+	return bridgeID, hw.String()
+}
+
+// SerialNumber returns the serial number of the bridge in its UPnP
+// description: its MAC address in lowercase hex without separators
+func (c BridgeConfig) SerialNumber() string {
+	return strings.ToLower(strings.ReplaceAll(c.MAC, ":", ""))
+}
+
+// UDN returns the UPnP unique device name of the bridge, which like on a
+// real bridge ends with its MAC address
+func (c BridgeConfig) UDN() string {
+	return "uuid:2f402f80-da50-11e1-9b23-" + c.SerialNumber()
+}
+
+// ModelName returns the UPnP model name of the bridge model
+func (c BridgeConfig) ModelName() string {
+	if c.ModelID == "BSB001" {
+		return "Philips hue bridge 2012"
+	}
+	return "Philips hue bridge 2015"
+}
+
+// Config returns the current configuration of the bridge
+func (b *HueBridge) Config() BridgeConfig {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	config := b.config
+	now := b.Now()
+	config.UTC = now.UTC().Format(timeLayout)
+	config.LocalTime = now.UTC().Format(timeLayout)
+	if loc, err := time.LoadLocation(config.Timezone); err == nil {
+		config.LocalTime = now.In(loc).Format(timeLayout)
+	}
+	config.LinkButton = b.linkButtonRemainingLocked() > 0
+	config.Whitelist = make(map[string]WhitelistEntry, len(b.whitelist))
+	for username, entry := range b.whitelist {
+		config.Whitelist[username] = *entry
+	}
+	return config
+}
+
+// requestConfig returns the configuration as seen by the client of r. With
+// DHCP the reported IP address is the one the client reached the bridge on.
+func (b *HueBridge) requestConfig(r *http.Request) BridgeConfig {
+	config := b.Config()
+	if config.DHCP || config.IPAddress == "" {
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+				config.IPAddress = host
+			}
+		}
+	}
+	return config
+}
+
+func handleGetConfig(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.requestConfig(r))
+}
+
+// handleGetShortConfig serves the configuration readable without a user
+func handleGetShortConfig(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	config := bridge.Config()
+	writeJSON(w, shortConfig{
+		Name:             config.Name,
+		DatastoreVersion: config.DatastoreVersion,
+		SWVersion:        config.SWVersion,
+		APIVersion:       config.APIVersion,
+		MAC:              config.MAC,
+		BridgeID:         config.BridgeID,
+		FactoryNew:       config.FactoryNew,
+		ReplacesBridgeID: config.ReplacesBridgeID,
+		ModelID:          config.ModelID,
+		StarterKitID:     config.StarterKitID,
+	})
+}
+
+func handleUpdateConfig(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	body, ok := decodeBody(w, r, "/config")
+	if !ok {
+		return
+	}
+
+	var responses []interface{}
+	for _, name := range sortedKeys(body) {
+		raw := body[name]
+		address := "/config/" + name
+		value, errType := bridge.updateConfig(name, raw)
+		switch errType {
+		case 0:
+			responses = append(responses, newSuccess(address, value))
+		case errInvalidValue:
+			responses = append(responses, newAPIError(errInvalidValue, address, rawValue(raw), name))
+		default:
+			responses = append(responses, newAPIError(errType, address, name))
+		}
+	}
+
+	writeJSON(w, responses)
+}
+
+// updateConfig sets a single configuration attribute. It returns the value
+// to report, or the v1 error type if the attribute cannot be set.
+func (b *HueBridge) updateConfig(name string, raw json.RawMessage) (interface{}, int) {
+	switch name {
+	case "name":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || len(v) < 4 || len(v) > 16 {
+			return nil, errInvalidValue
+		}
+		b.mu.Lock()
+		b.config.Name = v
+		b.mu.Unlock()
+		return v, 0
+	case "zigbeechannel":
+		var v int
+		if json.Unmarshal(raw, &v) != nil || (v != 11 && v != 15 && v != 20 && v != 25) {
+			return nil, errInvalidValue
+		}
+		b.mu.Lock()
+		b.config.ZigbeeChannel = v
+		b.mu.Unlock()
+		return v, 0
+	case "timezone":
+		var v string
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		if _, err := time.LoadLocation(v); err != nil || v == "" || v == "Local" {
+			return nil, errInvalidValue
+		}
+		b.mu.Lock()
+		b.config.Timezone = v
+		b.mu.Unlock()
+		return v, 0
+	case "ipaddress", "netmask", "gateway":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || net.ParseIP(v).To4() == nil {
+			return nil, errInvalidValue
+		}
+		b.mu.Lock()
+		switch name {
+		case "ipaddress":
+			b.config.IPAddress = v
+		case "netmask":
+			b.config.Netmask = v
+		case "gateway":
+			b.config.Gateway = v
+		}
+		b.mu.Unlock()
+		return v, 0
+	case "proxyaddress":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || len(v) > 40 || strings.ContainsAny(v, " /") {
+			return nil, errInvalidValue
+		}
+		b.mu.Lock()
+		b.config.ProxyAddress = v
+		b.mu.Unlock()
+		return v, 0
+	case "proxyport":
+		var v uint16
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		b.mu.Lock()
+		b.config.ProxyPort = int(v)
+		b.mu.Unlock()
+		return v, 0
+	case "dhcp":
+		var v bool
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		b.mu.Lock()
+		b.config.DHCP = v
+		b.mu.Unlock()
+		return v, 0
+	case "linkbutton":
+		var v bool
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		if v {
+			b.PressLinkButton()
+		}
+		return v, 0
+	case "portalservices":
+		var v bool
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		b.mu.Lock()
+		b.config.PortalServices = v
+		b.mu.Unlock()
+		return v, 0
+	case "touchlink":
+		var v bool
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		return v, 0
+	case "bridgeid", "mac", "modelid", "swversion", "apiversion", "datastoreversion",
+		"whitelist", "portalconnection", "factorynew", "replacesbridgeid", "starterkitid", "UTC", "localtime":
+		return nil, errParameterNotModifiable
+	}
+	return nil, errParameterNotAvailable
+}
@@ -0,0 +1,70 @@
+package hue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGetConfig(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#config")
+	h := b.Handler()
+
+	tests := []struct {
+		path      string
+		whitelist bool
+	}{
+		{"/api/config", false},
+		{"/api/owner/config", true},
+	}
+	for _, tt := range tests {
+		var config map[string]interface{}
+		rec := serve(h, "GET", tt.path, "", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+			t.Fatalf("GET %s = %s", tt.path, rec.Body)
+		}
+		if config["modelid"] != bridgeModelID || config["apiversion"] != bridgeAPIVersion || config["bridgeid"] == "" {
+			t.Errorf("GET %s = %s, lacks the bridge identity", tt.path, rec.Body)
+		}
+		whitelist, exists := config["whitelist"].(map[string]interface{})
+		if exists != tt.whitelist || (exists && whitelist["owner"] == nil) {
+			t.Errorf("GET %s whitelist = %v, want it reported: %v", tt.path, config["whitelist"], tt.whitelist)
+		}
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"name":"Living room"}`, `[{"success":{"/config/name":"Living room"}}]`},
+		{`{"name":"Hue"}`, `"type":7`},
+		{`{"zigbeechannel":15}`, `[{"success":{"/config/zigbeechannel":15}}]`},
+		{`{"zigbeechannel":12}`, `"type":7`},
+		{`{"timezone":"Europe/Paris"}`, `[{"success":{"/config/timezone":"Europe/Paris"}}]`},
+		{`{"timezone":"Mars/Olympus"}`, `"type":7`},
+		{`{"ipaddress":"192.168.1.300"}`, `"type":7`},
+		{`{"bridgeid":"001788FFFE000000"}`, `"type":8`},
+		{`{"colour":"blue"}`, `"type":6`},
+	}
+	for _, tt := range tests {
+		b := NewHueBridge(0)
+		b.AddUser("owner", "test#config")
+		rec := serve(b.Handler(), "PUT", "/api/owner/config", tt.body, "")
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("PUT %s = %s, want %s", tt.body, rec.Body, tt.want)
+		}
+		b.Close()
+	}
+
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#config")
+	serve(b.Handler(), "PUT", "/api/owner/config", `{"name":"Living room","timezone":"Europe/Paris"}`, "")
+	if config := b.Config(); config.Name != "Living room" || config.Timezone != "Europe/Paris" {
+		t.Errorf("config = %q in %q after the update", config.Name, config.Timezone)
+	}
+}
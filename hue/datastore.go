@@ -0,0 +1,68 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// datastoreSection is a top-level resource collection of the v1 API
+type datastoreSection struct {
+	name string
+	// get returns the content of the section as served by GET /api/<user>
+	get func(bridge *HueBridge, r *http.Request) interface{}
+}
+
+// datastoreSections lists the sections of the full datastore, in the order
+// of the real bridge. Every resource collection of the bridge registers
+// here so that it is part of the dump returned by GET /api/<user>.
+var datastoreSections = []datastoreSection{
+	{"lights", func(bridge *HueBridge, _ *http.Request) interface{} { return bridge.v1Lights() }},
+	{"groups", func(bridge *HueBridge, _ *http.Request) interface{} { return bridge.v1Groups() }},
+	{"config", func(bridge *HueBridge, r *http.Request) interface{} { return bridge.requestConfig(r) }},
+	{"schedules", func(bridge *HueBridge, _ *http.Request) interface{} { return bridge.v1Schedules() }},
+	{"scenes", func(bridge *HueBridge, _ *http.Request) interface{} { return bridge.v1Scenes() }},
+	{"rules", func(bridge *HueBridge, _ *http.Request) interface{} { return bridge.v1Rules() }},
+	{"sensors", func(bridge *HueBridge, _ *http.Request) interface{} { return bridge.v1Sensors() }},
+	{"resourcelinks", func(bridge *HueBridge, _ *http.Request) interface{} { return bridge.v1ResourceLinks() }},
+}
+
+// handleGetDatastore serves GET /api/<user>, the whole bridge state in one call
+func handleGetDatastore(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	datastore := make(map[string]interface{}, len(datastoreSections))
+	for _, section := range datastoreSections {
+		datastore[section.name] = section.get(bridge, r)
+	}
+	writeJSON(w, datastore)
+}
+
+// resolveAddress returns the value at a v1 resource address such as
+// /lights/1/state/on or /config/localtime, as it would be decoded from the
+// JSON of the datastore. It returns false if there is no such value.
+func (b *HueBridge) resolveAddress(address string) (interface{}, bool) {
+	parts := strings.Split(strings.Trim(address, "/"), "/")
+	for _, section := range datastoreSections {
+		if section.name != parts[0] {
+			continue
+		}
+		data, err := json.Marshal(section.get(b, new(http.Request)))
+		if err != nil {
+			return nil, false
+		}
+		var value interface{}
+		if json.Unmarshal(data, &value) != nil {
+			return nil, false
+		}
+		for _, part := range parts[1:] {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[part]; !ok {
+				return nil, false
+			}
+		}
+		return value, true
+	}
+	return nil, false
+}
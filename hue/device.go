@@ -0,0 +1,173 @@
+package hue
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// V2ResourceRef references another CLIP v2 resource
+type V2ResourceRef struct {
+	RID   string `json:"rid"`
+	RType string `json:"rtype"`
+}
+
+// V2Device is the CLIP v2 device owning a light
+type V2Device struct {
+	ID          string          `json:"id"`
+	IDV1        string          `json:"id_v1"`
+	ProductData V2ProductData   `json:"product_data"`
+	Metadata    V2Metadata      `json:"metadata"`
+	Services    []V2ResourceRef `json:"services"`
+	Type        string          `json:"type"`
+}
+
+// V2ProductData describes the product of a device
+type V2ProductData struct {
+	ModelID          string `json:"model_id"`
+	ManufacturerName string `json:"manufacturer_name"`
+	ProductName      string `json:"product_name"`
+	ProductArchetype string `json:"product_archetype"`
+	Certified        bool   `json:"certified"`
+	SoftwareVersion  string `json:"software_version"`
+}
+
+// productForModel returns the product name and archetype of a light model
+// ID. Unknown models are assumed to be color bulbs.
+func productForModel(modelID string) (string, string) {
+	switch {
+	case modelID == "LCT003" || modelID == "LCT011":
+		return "Hue color spot", "spot_bulb"
+	case modelID == "LLC020":
+		return "Hue go", "hue_go"
+	case modelID == "LLC010":
+		return "Hue iris", "hue_iris"
+	case strings.HasPrefix(modelID, "LLC"):
+		return "Hue bloom", "hue_bloom"
+	case strings.HasPrefix(modelID, "LST"):
+		return "Hue lightstrip plus", "hue_lightstrip"
+	case strings.HasPrefix(modelID, "LTW"):
+		return "Hue white ambiance lamp", "classic_bulb"
+	}
+	return "Hue color lamp", "sultan_bulb"
+}
+
+// softwareVersion returns the v2 software version of a v1 one, without
+// its build suffix, e.g. "1.65.11" for "1.65.11_r26581"
+func softwareVersion(swVersion string) string {
+	if i := strings.Index(swVersion, "_"); i >= 0 {
+		return swVersion[:i]
+	}
+	return swVersion
+}
+
+func convertToV2Device(light *HueLight) V2Device {
+	productName, archetype := productForModel(light.ModelID)
+	return V2Device{
+		ID:   light.deviceID,
+		IDV1: "/lights/" + light.v1ID,
+		ProductData: V2ProductData{
+			ModelID:          light.ModelID,
+			ManufacturerName: light.Manufacturer,
+			ProductName:      productName,
+			ProductArchetype: archetype,
+			Certified:        light.Capabilities.Certified,
+			SoftwareVersion:  softwareVersion(light.SWVersion),
+		},
+		Metadata: V2Metadata{
+			Name:      light.DisplayName(),
+			Archetype: archetype,
+		},
+		Services: []V2ResourceRef{{RID: light.ID, RType: "light"}},
+		Type:     "device",
+	}
+}
+
+// deviceEventData returns the reference of the device of a light in events
+func deviceEventData(light *HueLight) map[string]interface{} {
+	return map[string]interface{}{
+		"id":    light.deviceID,
+		"id_v1": "/lights/" + light.v1ID,
+		"type":  "device",
+	}
+}
+
+// lightByDeviceID finds a light by the ID of its device
+func (b *HueBridge) lightByDeviceID(id string) (*HueLight, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.lightByDeviceIDLocked(id)
+}
+
+// lightByDeviceIDLocked finds a light by the ID of its device; b.mu must be
+// held
+func (b *HueBridge) lightByDeviceIDLocked(id string) (*HueLight, bool) {
+	for _, light := range b.lights {
+		if light.deviceID == id {
+			return light, true
+		}
+	}
+	return nil, false
+}
+
+func handleGetV2Devices(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	devices := []V2Device{}
+	for _, id := range bridge.LightIDs() {
+		if light, exists := bridge.Light(id); exists {
+			devices = append(devices, convertToV2Device(light))
+		}
+	}
+	writeV2Data(w, devices)
+}
+
+func handleGetV2Device(w http.ResponseWriter, _ *http.Request, deviceID string, bridge *HueBridge) {
+	light, exists := bridge.lightByDeviceID(deviceID)
+	if !exists {
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeV2Data(w, []V2Device{convertToV2Device(light)})
+}
+
+// handleUpdateV2Device handles PUT /clip/v2/resource/device/{id}, which
+// renames the device and its light or makes the light blink to identify it
+func handleUpdateV2Device(w http.ResponseWriter, r *http.Request, deviceID string, bridge *HueBridge) {
+	var update struct {
+		Metadata *struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Identify *struct {
+			Action string `json:"action"`
+		} `json:"identify"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeV2Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	light, exists := bridge.lightByDeviceID(deviceID)
+	if !exists {
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	if update.Metadata != nil {
+		if update.Metadata.Name == "" || len(update.Metadata.Name) > 32 {
+			writeV2Error(w, http.StatusBadRequest, "invalid value for metadata.name")
+			return
+		}
+		light.rename(update.Metadata.Name)
+	}
+	if update.Identify != nil {
+		if update.Identify.Action != "identify" {
+			writeV2Error(w, http.StatusBadRequest, "invalid value for identify.action")
+			return
+		}
+		alert := "select"
+		light.updateLightState(StateUpdate{Alert: &alert})
+	}
+
+	writeV2Data(w, []V2ResourceRef{{RID: deviceID, RType: "device"}})
+
+	log.Printf("V2 Device %s updated via CLIP API", deviceID)
+}
@@ -0,0 +1,72 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestProductForModel(t *testing.T) {
+	tests := []struct {
+		modelID, name, archetype string
+	}{
+		{"LCT016", "Hue color lamp", "sultan_bulb"},
+		{"LCT003", "Hue color spot", "spot_bulb"},
+		{"LLC020", "Hue go", "hue_go"},
+		{"LLC010", "Hue iris", "hue_iris"},
+		{"LLC011", "Hue bloom", "hue_bloom"},
+		{"LST002", "Hue lightstrip plus", "hue_lightstrip"},
+		{"LTW001", "Hue white ambiance lamp", "classic_bulb"},
+	}
+	for _, tt := range tests {
+		if name, archetype := productForModel(tt.modelID); name != tt.name || archetype != tt.archetype {
+			t.Errorf("productForModel(%q) = %q, %q, want %q, %q", tt.modelID, name, archetype, tt.name, tt.archetype)
+		}
+	}
+}
+
+func TestV2Device(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#devices")
+	b.CreateLight(1)
+	b.CreateLight(2)
+	h := b.Handler()
+	light, _ := b.Light("1")
+	path := "/clip/v2/resource/device/" + light.deviceID
+
+	var list struct {
+		Data []V2Device `json:"data"`
+	}
+	rec := serve(h, "GET", "/clip/v2/resource/device", "", "owner")
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Data) != 2 {
+		t.Fatalf("GET /device = %s", rec.Body)
+	}
+	device := list.Data[0]
+	if device.ID != light.deviceID || device.IDV1 != "/lights/1" || device.ProductData.SoftwareVersion != "1.65.11" ||
+		len(device.Services) != 1 || device.Services[0] != (V2ResourceRef{RID: light.ID, RType: "light"}) {
+		t.Errorf("device = %+v", device)
+	}
+
+	tests := []struct {
+		name, path, body string
+		status           int
+	}{
+		{"rename", path, `{"metadata":{"name":"Desk"}}`, http.StatusOK},
+		{"empty name", path, `{"metadata":{"name":""}}`, http.StatusBadRequest},
+		{"identify", path, `{"identify":{"action":"identify"}}`, http.StatusOK},
+		{"unknown action", path, `{"identify":{"action":"blink"}}`, http.StatusBadRequest},
+		{"unknown device", "/clip/v2/resource/device/unknown", `{"metadata":{"name":"Desk"}}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := serve(h, "PUT", tt.path, tt.body, "owner"); rec.Code != tt.status {
+			t.Errorf("%s: PUT = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.status)
+		}
+	}
+	if name := light.DisplayName(); name != "Desk" {
+		t.Errorf("light name = %q after renaming its device", name)
+	}
+	if alert := light.Snapshot().Alert; alert != "select" {
+		t.Errorf("light alert = %q after identifying its device", alert)
+	}
+}
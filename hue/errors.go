@@ -0,0 +1,109 @@
+package hue
+
+import "fmt"
+
+// v1 API error types, as returned by the real bridge
+const (
+	errUnauthorizedUser         = 1
+	errInvalidJSON              = 2
+	errResourceNotAvailable     = 3
+	errMethodNotAvailable       = 4
+	errMissingParameters        = 5
+	errParameterNotAvailable    = 6
+	errInvalidValue             = 7
+	errParameterNotModifiable   = 8
+	errTooManyItems             = 11
+	errPortalConnectionRequired = 12
+	errLinkButtonNotPressed     = 101
+	errDHCPCannotBeDisabled     = 110
+	errInvalidUpdateState       = 111
+	errDeviceIsOff              = 201
+	errGroupTableFull           = 301
+	errDeviceGroupTableFull     = 302
+	errGroupTypeNotModifiable   = 305
+	errLightAlreadyInRoom       = 306
+	errSceneCreationInProgress  = 401
+	errSceneBufferFull          = 402
+	errSceneInUse               = 403
+	errSensorTypeNotAllowed     = 501
+	errSensorListFull           = 502
+	errRuleEngineFull           = 601
+	errRuleConditionError       = 607
+	errRuleActionError          = 608
+	errRuleUnableToActivate     = 609
+	errScheduleListFull         = 701
+	errScheduleTimezoneInvalid  = 702
+	errScheduleTimeConflict     = 703
+	errScheduleCannotCreate     = 704
+	errScheduleTimeInPast       = 705
+	errScheduleCommandError     = 706
+	errInternal                 = 901
+	// The Hue API documents no error for a full resource link table
+	errResourceLinkTableFull = 1101
+)
+
+// errorDescriptions holds the description format of every error type. The
+// arguments are documented next to each entry.
+var errorDescriptions = map[int]string{
+	errUnauthorizedUser:         "unauthorized user",
+	errInvalidJSON:              "body contains invalid json",
+	errResourceNotAvailable:     "resource, %s, not available",                // address
+	errMethodNotAvailable:       "method, %s, not available for resource, %s", // method, address
+	errMissingParameters:        "invalid/missing parameters in body",
+	errParameterNotAvailable:    "parameter, %s, not available",         // parameter
+	errInvalidValue:             "invalid value, %v, for parameter, %s", // value, parameter
+	errParameterNotModifiable:   "parameter, %s, is not modifiable",     // parameter
+	errTooManyItems:             "too many items in list",
+	errPortalConnectionRequired: "Portal connection required",
+	errLinkButtonNotPressed:     "link button not pressed",
+	errDHCPCannotBeDisabled:     "DHCP cannot be disabled",
+	errInvalidUpdateState:       "Invalid updatestate",
+	errDeviceIsOff:              "parameter, %s, is not modifiable. Device is set to off.", // parameter
+	errGroupTableFull:           "group could not be created. Group table is full.",
+	errDeviceGroupTableFull:     "device, %s, could not be added to group. Device's group table is full.", // device
+	errGroupTypeNotModifiable:   "It is not allowed to update or delete group of this type",
+	errLightAlreadyInRoom:       "device, %s, is already used in another room", // device
+	errSceneCreationInProgress:  "scene could not be created. Scene creation in progress.",
+	errSceneBufferFull:          "scene could not be created. Scene buffer in bridge full",
+	errSceneInUse:               "scene couldn't be removed, because the scene is still being used",
+	errSensorTypeNotAllowed:     "Not allowed to create sensor type",
+	errSensorListFull:           "Sensor list is full",
+	errRuleEngineFull:           "Rule engine full",
+	errRuleConditionError:       "Condition error",
+	errRuleActionError:          "Action error",
+	errRuleUnableToActivate:     "Unable to activate",
+	errScheduleListFull:         "Schedule list is full.",
+	errScheduleTimezoneInvalid:  "Schedule time-zone not valid.",
+	errScheduleTimeConflict:     "Schedule cannot set time and local time.",
+	errScheduleCannotCreate:     "Cannot create schedule",
+	errScheduleTimeInPast:       "Cannot enable schedule, time is in the past.",
+	errScheduleCommandError:     "Command error",
+	errInternal:                 "Internal error, %d", // error code
+	errResourceLinkTableFull:    "resourcelink could not be created. Resourcelink table is full.",
+}
+
+// apiError is a v1 API error entry
+type apiError struct {
+	Type        int    `json:"type"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+}
+
+// newAPIError builds a v1 error response entry for the given error type and
+// address, formatting the description with args.
+func newAPIError(errType int, address string, args ...interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"error": apiError{
+			Type:        errType,
+			Address:     address,
+			Description: fmt.Sprintf(errorDescriptions[errType], args...),
+		},
+	}
+}
+
+// newSuccess builds a v1 success response entry setting address to value
+func newSuccess(address string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"success": map[string]interface{}{address: value},
+	}
+}
@@ -0,0 +1,220 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// eventBatchInterval is how long changes are collected before they are
+	// sent together, as the bridge does to spare its clients
+	eventBatchInterval = 250 * time.Millisecond
+	// eventKeepAlive is how often an idle stream gets a comment, so proxies
+	// and clients do not drop the connection
+	eventKeepAlive = 30 * time.Second
+	// eventBuffer is the number of messages a slow client can lag behind
+	// before its stream is closed
+	eventBuffer = 16
+)
+
+// Types of CLIP v2 events
+const (
+	eventUpdate = "update"
+	eventAdd    = "add"
+	eventDelete = "delete"
+)
+
+// v2Event is a CLIP v2 event, carrying the changed attributes of resources
+type v2Event struct {
+	CreationTime string        `json:"creationtime"`
+	Data         []interface{} `json:"data"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+}
+
+// eventStream batches resource changes and sends them to the clients of
+// /eventstream/clip/v2
+type eventStream struct {
+	// pending holds the data of the batch being collected, by event type
+	pending map[string][]interface{}
+	// flushing is set while a batch is being collected
+	flushing bool
+	// seq numbers the messages sent
+	seq int
+	// clients holds the message channel of every connected client
+	clients map[chan string]bool
+	mu      sync.Mutex
+}
+
+// subscribe returns a channel receiving the messages of the stream. The
+// channel is closed if the client falls too far behind.
+func (s *eventStream) subscribe() chan string {
+	ch := make(chan string, eventBuffer)
+	s.mu.Lock()
+	if s.clients == nil {
+		s.clients = make(map[chan string]bool)
+	}
+	s.clients[ch] = true
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *eventStream) unsubscribe(ch chan string) {
+	s.mu.Lock()
+	if s.clients[ch] {
+		delete(s.clients, ch)
+		close(ch)
+	}
+	s.mu.Unlock()
+}
+
+// publish adds the partial representation of a resource to the current
+// batch, which is sent after eventBatchInterval
+func (s *eventStream) publish(eventType string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+	if s.pending == nil {
+		s.pending = make(map[string][]interface{})
+	}
+	s.pending[eventType] = append(s.pending[eventType], data)
+	if !s.flushing {
+		s.flushing = true
+		time.AfterFunc(eventBatchInterval, s.flush)
+	}
+}
+
+// flush sends the current batch as one message, with an event per type
+func (s *eventStream) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var events []v2Event
+	for _, eventType := range []string{eventAdd, eventUpdate, eventDelete} {
+		if data := s.pending[eventType]; len(data) > 0 {
+			events = append(events, v2Event{
+				CreationTime: now.UTC().Format(time.RFC3339),
+				Data:         data,
+				ID:           uuid.New().String(),
+				Type:         eventType,
+			})
+		}
+	}
+	s.pending = nil
+	s.flushing = false
+	if len(events) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(events)
+	if err != nil {
+		log.Printf("Error encoding events: %v", err)
+		return
+	}
+	message := fmt.Sprintf("id: %d:%d\ndata: %s\n\n", now.Unix(), s.seq, payload)
+	s.seq++
+	for ch := range s.clients {
+		select {
+		case ch <- message:
+		default:
+			log.Printf("Event stream client too slow, closing its stream")
+			delete(s.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// lightEventData returns the reference of a light in events
+func lightEventData(light *HueLight) map[string]interface{} {
+	return map[string]interface{}{
+		"id":    light.ID,
+		"id_v1": "/lights/" + light.v1ID,
+		"type":  "light",
+	}
+}
+
+// publishLightChange publishes the attributes of a light that differ from
+// its previous state and name, if any
+func (b *HueBridge) publishLightChange(light *HueLight, before LightState, beforeName string) {
+	after := light.Snapshot()
+	data := lightEventData(light)
+	if after.On != before.On {
+		data["on"] = V2OnState{On: after.On}
+	}
+	if after.Brightness != before.Brightness {
+		data["dimming"] = map[string]float64{"brightness": float64(after.Brightness) / 254.0 * 100.0}
+	}
+	if after.XY != before.XY {
+		data["color"] = map[string]interface{}{"xy": V2XY{X: after.XY[0], Y: after.XY[1]}}
+	}
+	if after.ColorTemp != before.ColorTemp || (after.ColorMode == "ct") != (before.ColorMode == "ct") {
+		data["color_temperature"] = map[string]interface{}{
+			"mirek":       after.ColorTemp,
+			"mirek_valid": after.ColorMode == "ct",
+		}
+	}
+	if name := light.DisplayName(); name != beforeName {
+		data["metadata"] = map[string]string{"name": name}
+		device := deviceEventData(light)
+		device["metadata"] = map[string]string{"name": name}
+		b.events.publish(eventUpdate, device)
+	}
+	if len(data) > 3 {
+		b.events.publish(eventUpdate, data)
+	}
+	if after.On != before.On || after.Brightness != before.Brightness {
+		b.publishGroupedLightsOf(light.v1ID)
+	}
+}
+
+// handleEventStream serves GET /eventstream/clip/v2, which sends CLIP v2
+// events as Server-Sent Events until the client disconnects
+func handleEventStream(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	if r.Method != "GET" {
+		writeV2Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !bridge.authorize(r.Header.Get("hue-application-key")) {
+		writeV2Error(w, http.StatusForbidden, "unauthorized user")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeV2Error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	messages := bridge.events.subscribe()
+	defer bridge.events.unsubscribe(messages)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": hi\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message, open := <-messages:
+			if !open {
+				return
+			}
+			fmt.Fprint(w, message)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,183 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// eventMessagePattern matches a Server-Sent Events message of the stream
+var eventMessagePattern = regexp.MustCompile(`^id: (\d+):(\d+)\ndata: (.*)\n\n$`)
+
+// receiveEvents waits for the next message of the stream and decodes it
+func receiveEvents(t *testing.T, ch chan string) (unix int64, seq int, events []v2Event) {
+	t.Helper()
+	select {
+	case message := <-ch:
+		m := eventMessagePattern.FindStringSubmatch(message)
+		if m == nil {
+			t.Fatalf("malformed message %q", message)
+		}
+		unix, _ = strconv.ParseInt(m[1], 10, 64)
+		seq, _ = strconv.Atoi(m[2])
+		if err := json.Unmarshal([]byte(m[3]), &events); err != nil {
+			t.Fatalf("decoding %s: %v", m[3], err)
+		}
+		return unix, seq, events
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+	}
+	return 0, 0, nil
+}
+
+func TestEventBatching(t *testing.T) {
+	type published struct {
+		eventType string
+		id        string
+	}
+	tests := []struct {
+		name      string
+		published []published
+		// want holds the type of every event of the message and the IDs of
+		// its data
+		want [][2]string
+	}{
+		{
+			name:      "single update",
+			published: []published{{eventUpdate, "a"}},
+			want:      [][2]string{{eventUpdate, "a"}},
+		},
+		{
+			name:      "updates together",
+			published: []published{{eventUpdate, "a"}, {eventUpdate, "b"}},
+			want:      [][2]string{{eventUpdate, "a,b"}},
+		},
+		{
+			name:      "add, update and delete order",
+			published: []published{{eventDelete, "c"}, {eventUpdate, "b"}, {eventAdd, "a"}, {eventUpdate, "d"}},
+			want:      [][2]string{{eventAdd, "a"}, {eventUpdate, "b,d"}, {eventDelete, "c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s eventStream
+			ch := s.subscribe()
+			defer s.unsubscribe(ch)
+			for _, p := range tt.published {
+				s.publish(p.eventType, map[string]string{"id": p.id})
+			}
+
+			_, _, events := receiveEvents(t, ch)
+			var got [][2]string
+			for _, e := range events {
+				ids := ""
+				for i, data := range e.Data {
+					if i > 0 {
+						ids += ","
+					}
+					ids += fmt.Sprint(data.(map[string]interface{})["id"])
+				}
+				got = append(got, [2]string{e.Type, ids})
+				if e.ID == "" || e.CreationTime == "" {
+					t.Errorf("event %+v lacks an id or creation time", e)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventIDs(t *testing.T) {
+	var s eventStream
+	ch := s.subscribe()
+	defer s.unsubscribe(ch)
+
+	before := time.Now().Unix()
+	for want := 0; want < 3; want++ {
+		s.publish(eventUpdate, map[string]string{"id": "a"})
+		unix, seq, _ := receiveEvents(t, ch)
+		if seq != want {
+			t.Errorf("message %d has sequence number %d", want, seq)
+		}
+		if unix < before || unix > time.Now().Unix() {
+			t.Errorf("message %d has time %d, want the current time", want, unix)
+		}
+	}
+}
+
+func TestEventStreamWithoutClients(t *testing.T) {
+	var s eventStream
+	s.publish(eventUpdate, map[string]string{"id": "a"})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending != nil || s.flushing {
+		t.Error("events were collected without clients")
+	}
+}
+
+func TestEventStreamSlowClient(t *testing.T) {
+	var s eventStream
+	ch := s.subscribe()
+	for i := 0; i <= eventBuffer; i++ {
+		s.publish(eventUpdate, map[string]string{"id": "a"})
+		s.flush()
+	}
+	for i := 0; i < eventBuffer; i++ {
+		<-ch
+	}
+	if _, open := <-ch; open {
+		t.Error("the stream of a slow client was not closed")
+	}
+}
+
+func TestLightColorTemperatureEvents(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#events")
+	b.CreateLight(1)
+	h := b.Handler()
+	ch := b.events.subscribe()
+	defer b.events.unsubscribe(ch)
+
+	tests := []struct {
+		body string
+		want V2CT
+	}{
+		{`{"color_temperature":{"mirek":300}}`, V2CT{Mirek: 300, MirekValid: true}},
+		{`{"color":{"xy":{"x":0.3,"y":0.3}}}`, V2CT{Mirek: 300, MirekValid: false}},
+	}
+	for _, tt := range tests {
+		if rec := serve(h, "PUT", "/clip/v2/resource/light/1", tt.body, "owner"); rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s = %d %s", tt.body, rec.Code, rec.Body)
+		}
+
+		// Events carry the color temperature at the top level, like the light
+		b.events.flush()
+		_, _, events := receiveEvents(t, ch)
+		data, _ := json.Marshal(events[0].Data[0])
+		var event, resource struct {
+			ColorTemperature *V2CT `json:"color_temperature"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil || event.ColorTemperature == nil ||
+			event.ColorTemperature.Mirek != tt.want.Mirek || event.ColorTemperature.MirekValid != tt.want.MirekValid {
+			t.Errorf("%s: event %s, want color_temperature %+v", tt.body, data, tt.want)
+		}
+		var light struct {
+			Data []json.RawMessage `json:"data"`
+		}
+		rec := serve(h, "GET", "/clip/v2/resource/light/1", "", "owner")
+		if err := json.Unmarshal(rec.Body.Bytes(), &light); err != nil || len(light.Data) != 1 {
+			t.Fatalf("GET = %s", rec.Body)
+		}
+		json.Unmarshal(light.Data[0], &resource)
+		if ct := resource.ColorTemperature; ct == nil || ct.Mirek != tt.want.Mirek || ct.MirekValid != tt.want.MirekValid || ct.MirekSchema == nil {
+			t.Errorf("%s: light %s, want color_temperature %+v", tt.body, light.Data[0], tt.want)
+		}
+	}
+}
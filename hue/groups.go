@@ -0,0 +1,453 @@
+package hue
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// Group types supported by the v1 API
+const (
+	groupTypeLightGroup = "LightGroup"
+	groupTypeRoom       = "Room"
+	groupTypeZone       = "Zone"
+)
+
+// allLightsGroupID is the implicit group holding every light of the bridge
+const allLightsGroupID = "0"
+
+// roomClasses lists the classes a room or zone can be given
+var roomClasses = map[string]bool{
+	"Living room": true, "Kitchen": true, "Dining": true, "Bedroom": true,
+	"Kids bedroom": true, "Bathroom": true, "Nursery": true, "Recreation": true,
+	"Office": true, "Gym": true, "Hallway": true, "Toilet": true,
+	"Front door": true, "Garage": true, "Terrace": true, "Garden": true,
+	"Driveway": true, "Carport": true, "Home": true, "Downstairs": true,
+	"Upstairs": true, "Top floor": true, "Attic": true, "Guest room": true,
+	"Staircase": true, "Lounge": true, "Man cave": true, "Computer": true,
+	"Studio": true, "Music": true, "TV": true, "Reading": true,
+	"Balcony": true, "Porch": true, "Barbecue": true, "Pool": true,
+	"Free": true, "Other": true,
+}
+
+// Group is a v1 group of lights
+type Group struct {
+	Name    string   `json:"name"`
+	Lights  []string `json:"lights"`
+	Sensors []string `json:"sensors"`
+	Type    string   `json:"type"`            // LightGroup, Room or Zone
+	Class   string   `json:"class,omitempty"` // rooms and zones only
+	Recycle bool     `json:"recycle"`
+
+	// v2ID is the ID of the CLIP v2 room or zone of the group
+	v2ID string
+	// groupedLightID is the ID of the CLIP v2 grouped light of the group
+	groupedLightID string
+}
+
+// GroupState summarizes the on state of the lights of a group
+type GroupState struct {
+	AllOn bool `json:"all_on"`
+	AnyOn bool `json:"any_on"`
+}
+
+// v1Group is the v1 representation of a group, with the state computed
+// from its lights. As the last action is not stored, the state of the
+// first light stands for it.
+type v1Group struct {
+	Group
+	State  GroupState `json:"state"`
+	Action LightState `json:"action"`
+}
+
+// allLightsGroupLocked returns group 0, which holds every light; b.mu must
+// be held
+func (b *HueBridge) allLightsGroupLocked() *Group {
+	ids := make([]string, 0, len(b.lights))
+	for id := range b.lights {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return &Group{
+		Name:    "Group 0",
+		Lights:  ids,
+		Sensors: []string{},
+		Type:    groupTypeLightGroup,
+	}
+}
+
+// groupLocked returns the group with the given v1 ID, including group 0;
+// b.mu must be held
+func (b *HueBridge) groupLocked(id string) (*Group, bool) {
+	if id == allLightsGroupID {
+		return b.allLightsGroupLocked(), true
+	}
+	group, exists := b.groups[id]
+	return group, exists
+}
+
+// v1GroupLocked computes the v1 representation of group; b.mu must be held
+func (b *HueBridge) v1GroupLocked(group *Group) v1Group {
+	v := v1Group{
+		Group:  *group,
+		State:  GroupState{AllOn: len(group.Lights) > 0},
+		Action: defaultLightState(),
+	}
+	v.Lights = append([]string{}, group.Lights...)
+	for i, id := range group.Lights {
+		light, exists := b.lights[id]
+		if !exists {
+			continue
+		}
+		state := light.Snapshot()
+		if i == 0 {
+			v.Action = state
+		}
+		v.State.AllOn = v.State.AllOn && state.On
+		v.State.AnyOn = v.State.AnyOn || state.On
+	}
+	return v
+}
+
+// v1Groups returns all groups but group 0 keyed by their v1 ID
+func (b *HueBridge) v1Groups() map[string]v1Group {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	groups := make(map[string]v1Group, len(b.groups))
+	for id, group := range b.groups {
+		groups[id] = b.v1GroupLocked(group)
+	}
+	return groups
+}
+
+// groupLights returns the lights of the group with the given v1 ID
+func (b *HueBridge) groupLights(id string) ([]*HueLight, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	group, exists := b.groupLocked(id)
+	if !exists {
+		return nil, false
+	}
+	lights := make([]*HueLight, 0, len(group.Lights))
+	for _, lightID := range group.Lights {
+		if light, exists := b.lights[lightID]; exists {
+			lights = append(lights, light)
+		}
+	}
+	return lights, true
+}
+
+// nextGroupIDLocked returns the lowest free group ID; b.mu must be held
+func (b *HueBridge) nextGroupIDLocked() string {
+	for n := 1; ; n++ {
+		if _, exists := b.groups[strconv.Itoa(n)]; !exists {
+			return strconv.Itoa(n)
+		}
+	}
+}
+
+// checkGroupLightsLocked decodes the lights of the group groupID of type
+// groupType. It returns the v1 error entry reported at address when a light
+// does not exist or, for rooms, already belongs to another room. b.mu must
+// be held.
+func (b *HueBridge) checkGroupLightsLocked(groupID, groupType string, raw json.RawMessage, address string) ([]string, map[string]interface{}) {
+	var ids []string
+	if json.Unmarshal(raw, &ids) != nil {
+		return nil, newAPIError(errInvalidValue, address, rawValue(raw), "lights")
+	}
+	lights := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if _, exists := b.lights[id]; !exists {
+			return nil, newAPIError(errInvalidValue, address, id, "lights")
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		lights = append(lights, id)
+	}
+	if groupType == groupTypeRoom {
+		for otherID, other := range b.groups {
+			if otherID == groupID || other.Type != groupTypeRoom {
+				continue
+			}
+			for _, id := range other.Lights {
+				if seen[id] {
+					return nil, newAPIError(errLightAlreadyInRoom, address, "/lights/"+id)
+				}
+			}
+		}
+	}
+	return lights, nil
+}
+
+func handleGetGroups(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.v1Groups())
+}
+
+func handleGetGroup(w http.ResponseWriter, _ *http.Request, groupID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	group, exists := bridge.groupLocked(groupID)
+	var v v1Group
+	if exists {
+		v = bridge.v1GroupLocked(group)
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/groups/"+groupID, "/groups/"+groupID)})
+		return
+	}
+	writeJSON(w, v)
+}
+
+// handleCreateGroup handles POST /groups. Rooms and zones may be created
+// empty, other groups need at least one light.
+func handleCreateGroup(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	body, ok := decodeBody(w, r, "/groups")
+	if !ok {
+		return
+	}
+
+	group := &Group{
+		Type:           groupTypeLightGroup,
+		Lights:         []string{},
+		Sensors:        []string{},
+		v2ID:           uuid.New().String(),
+		groupedLightID: uuid.New().String(),
+	}
+	if raw, exists := body["type"]; exists {
+		if json.Unmarshal(raw, &group.Type) != nil ||
+			(group.Type != groupTypeLightGroup && group.Type != groupTypeRoom && group.Type != groupTypeZone) {
+			writeJSON(w, []interface{}{newAPIError(errInvalidValue, "/groups/type", rawValue(raw), "type")})
+			return
+		}
+	}
+	if group.Type != groupTypeLightGroup {
+		group.Class = "Other"
+	}
+
+	var errors []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		address := "/groups/" + attr
+		switch attr {
+		case "type", "lights":
+			// Decoded before and after the loop respectively
+		case "name":
+			if json.Unmarshal(raw, &group.Name) != nil || group.Name == "" || len(group.Name) > 32 {
+				errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+			}
+		case "class":
+			if group.Type == groupTypeLightGroup {
+				errors = append(errors, newAPIError(errParameterNotAvailable, address, attr))
+			} else if json.Unmarshal(raw, &group.Class) != nil || !roomClasses[group.Class] {
+				errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+			}
+		case "recycle":
+			if json.Unmarshal(raw, &group.Recycle) != nil {
+				errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+			}
+		default:
+			errors = append(errors, newAPIError(errParameterNotAvailable, address, attr))
+		}
+	}
+	if len(errors) > 0 {
+		writeJSON(w, errors)
+		return
+	}
+
+	bridge.mu.Lock()
+	if len(bridge.groups) >= bridge.limits.Groups {
+		bridge.mu.Unlock()
+		writeJSON(w, []interface{}{newAPIError(errGroupTableFull, "/groups")})
+		return
+	}
+	id := bridge.nextGroupIDLocked()
+	if raw, exists := body["lights"]; exists {
+		lights, apiErr := bridge.checkGroupLightsLocked(id, group.Type, raw, "/groups/lights")
+		if apiErr != nil {
+			bridge.mu.Unlock()
+			writeJSON(w, []interface{}{apiErr})
+			return
+		}
+		group.Lights = lights
+	}
+	if len(group.Lights) == 0 && group.Type == groupTypeLightGroup {
+		bridge.mu.Unlock()
+		writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/groups")})
+		return
+	}
+	if group.Name == "" {
+		group.Name = "Group " + id
+	}
+	bridge.groups[id] = group
+	bridge.publishGroupLocked(eventAdd, id, group)
+	bridge.mu.Unlock()
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"id": id}}})
+
+	log.Printf("Group %s created: %s %q with lights %v", id, group.Type, group.Name, group.Lights)
+}
+
+// handleUpdateGroup handles PUT /groups/<id>, which changes the name, the
+// lights or the class of a group
+func handleUpdateGroup(w http.ResponseWriter, r *http.Request, groupID string, bridge *HueBridge) {
+	address := "/groups/" + groupID
+	if groupID == allLightsGroupID {
+		writeJSON(w, []interface{}{newAPIError(errGroupTypeNotModifiable, address)})
+		return
+	}
+
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	group, exists := bridge.groups[groupID]
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+
+	var responses []interface{}
+	changed := false
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		attrAddress := address + "/" + attr
+		switch attr {
+		case "name":
+			var name string
+			if json.Unmarshal(raw, &name) != nil || name == "" || len(name) > 32 {
+				responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), attr))
+				continue
+			}
+			group.Name = name
+			changed = true
+			responses = append(responses, newSuccess(attrAddress, name))
+		case "lights":
+			lights, apiErr := bridge.checkGroupLightsLocked(groupID, group.Type, raw, attrAddress)
+			if apiErr != nil {
+				responses = append(responses, apiErr)
+				continue
+			}
+			if len(lights) == 0 && group.Type == groupTypeLightGroup {
+				responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), attr))
+				continue
+			}
+			group.Lights = lights
+			changed = true
+			responses = append(responses, newSuccess(attrAddress, lights))
+		case "class":
+			var class string
+			if group.Type == groupTypeLightGroup {
+				responses = append(responses, newAPIError(errParameterNotAvailable, attrAddress, attr))
+				continue
+			}
+			if json.Unmarshal(raw, &class) != nil || !roomClasses[class] {
+				responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), attr))
+				continue
+			}
+			group.Class = class
+			changed = true
+			responses = append(responses, newSuccess(attrAddress, class))
+		case "type", "recycle", "sensors":
+			responses = append(responses, newAPIError(errParameterNotModifiable, attrAddress, attr))
+		default:
+			responses = append(responses, newAPIError(errParameterNotAvailable, attrAddress, attr))
+		}
+	}
+	if changed {
+		bridge.publishGroupLocked(eventUpdate, groupID, group)
+	}
+
+	writeJSON(w, responses)
+}
+
+func handleDeleteGroup(w http.ResponseWriter, _ *http.Request, groupID string, bridge *HueBridge) {
+	address := "/groups/" + groupID
+	if groupID == allLightsGroupID {
+		writeJSON(w, []interface{}{newAPIError(errGroupTypeNotModifiable, address)})
+		return
+	}
+
+	bridge.mu.Lock()
+	exists := bridge.deleteResourceLocked(address)
+	bridge.mu.Unlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+	writeJSON(w, []interface{}{map[string]interface{}{"success": address + " deleted"}})
+
+	log.Printf("Group %s deleted", groupID)
+}
+
+// handleGroupAction handles PUT /groups/<id>/action, which applies a state
+// update to every light of the group. Unlike on a single light, attributes
+// are accepted while lights are off. The scene attribute recalls a scene on
+// the lights of the group before the other attributes are applied.
+func handleGroupAction(w http.ResponseWriter, r *http.Request, groupID string, bridge *HueBridge) {
+	lights, exists := bridge.groupLights(groupID)
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/groups/"+groupID, "/groups/"+groupID)})
+		return
+	}
+
+	address := "/groups/" + groupID + "/action"
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	var sceneResponses []interface{}
+	if raw, exists := body["scene"]; exists {
+		delete(body, "scene")
+		var sceneID string
+		transitionTime := transitionTimeOf(body)
+		if json.Unmarshal(raw, &sceneID) != nil {
+			sceneResponses = append(sceneResponses, newAPIError(errInvalidValue, address+"/scene", rawValue(raw), "scene"))
+		} else if !bridge.recallScene(sceneID, groupID, transitionTime) {
+			sceneResponses = append(sceneResponses, newAPIError(errResourceNotAvailable, address+"/scene", "/scenes/"+sceneID))
+		} else {
+			sceneResponses = append(sceneResponses, newSuccess(address+"/scene", sceneID))
+		}
+		if _, exists := body["transitiontime"]; exists && len(body) == 1 && transitionTime != nil {
+			// The transition time only applies to the scene
+			sceneResponses = append(sceneResponses, newSuccess(address+"/transitiontime", *transitionTime))
+			delete(body, "transitiontime")
+		}
+		if len(body) == 0 {
+			writeJSON(w, sceneResponses)
+			return
+		}
+	}
+
+	// Each light clamps the values to its own capabilities
+	update, responses := parseStateUpdate(body, address, true, groupCapabilities)
+	bridge.lightsChanged(lights)
+	for _, light := range lights {
+		light.updateLightState(update)
+	}
+	responses = append(sceneResponses, responses...)
+
+	writeJSON(w, responses)
+
+	log.Printf("Group %s action applied to %d lights", groupID, len(lights))
+}
+
+// transitionTimeOf decodes the transition time of a v1 action, if valid
+func transitionTimeOf(body map[string]json.RawMessage) *uint16 {
+	var v uint16
+	if raw, exists := body["transitiontime"]; !exists || json.Unmarshal(raw, &v) != nil {
+		return nil
+	}
+	return &v
+}
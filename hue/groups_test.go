@@ -0,0 +1,98 @@
+package hue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGroupRequests(t *testing.T) {
+	tests := []struct {
+		name               string
+		method, path, body string
+		want               string
+	}{
+		{"light group", "POST", "/api/owner/groups", `{"name":"Desk","lights":["2"]}`, `[{"success":{"id":"2"}}]`},
+		{"light group without lights", "POST", "/api/owner/groups", `{"name":"Desk"}`, `"type":5`},
+		{"empty zone", "POST", "/api/owner/groups", `{"name":"Zone","type":"Zone","class":"Kitchen"}`, `[{"success":{"id":"2"}}]`},
+		{"light in another room", "POST", "/api/owner/groups", `{"type":"Room","lights":["1"]}`, `"type":306`},
+		{"unknown light", "POST", "/api/owner/groups", `{"lights":["9"]}`, `"type":7`},
+		{"unknown type", "POST", "/api/owner/groups", `{"type":"Luminaire","lights":["2"]}`, `"type":7`},
+		{"class of a light group", "POST", "/api/owner/groups", `{"class":"Kitchen","lights":["2"]}`, `"type":6`},
+		{"unknown class", "POST", "/api/owner/groups", `{"type":"Room","class":"Cellar"}`, `"type":7`},
+		{"get", "GET", "/api/owner/groups/1", "", `"name":"Room"`},
+		{"get group 0", "GET", "/api/owner/groups/0", "", `"lights":["1","2"]`},
+		{"get unknown group", "GET", "/api/owner/groups/9", "", `"type":3`},
+		{"update lights", "PUT", "/api/owner/groups/1", `{"lights":["1","2"]}`, `[{"success":{"/groups/1/lights":["1","2"]}}]`},
+		{"update class", "PUT", "/api/owner/groups/1", `{"class":"Office"}`, `[{"success":{"/groups/1/class":"Office"}}]`},
+		{"update type", "PUT", "/api/owner/groups/1", `{"type":"Zone"}`, `"type":8`},
+		{"update group 0", "PUT", "/api/owner/groups/0", `{"name":"All"}`, `"type":305`},
+		{"delete", "DELETE", "/api/owner/groups/1", "", `[{"success":"/groups/1 deleted"}]`},
+		{"delete group 0", "DELETE", "/api/owner/groups/0", "", `"type":305`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#groups")
+			b.CreateLight(1)
+			b.CreateLight(2)
+			h := b.Handler()
+			serve(h, "POST", "/api/owner/groups", `{"name":"Room","type":"Room","lights":["1"]}`, "")
+
+			rec := serve(h, tt.method, tt.path, tt.body, "")
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("%s %s %s = %s, want %s", tt.method, tt.path, tt.body, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupAction(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#groups")
+	b.CreateLight(1)
+	b.CreateLight(2)
+	h := b.Handler()
+	serve(h, "POST", "/api/owner/groups", `{"name":"Room","type":"Room","lights":["1"]}`, "")
+	state := func() GroupState {
+		t.Helper()
+		var group struct {
+			State GroupState `json:"state"`
+		}
+		rec := serve(h, "GET", "/api/owner/groups/1", "", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &group); err != nil {
+			t.Fatalf("GET /groups/1 = %s", rec.Body)
+		}
+		return group.State
+	}
+	light1, _ := b.Light("1")
+	light2, _ := b.Light("2")
+
+	// Attributes are accepted while the lights are off
+	rec := serve(h, "PUT", "/api/owner/groups/1/action", `{"bri":100}`, "")
+	if rec.Body.String() != `[{"success":{"/groups/1/action/bri":100}}]`+"\n" {
+		t.Errorf("action = %s", rec.Body)
+	}
+	if light1.Snapshot().Brightness != 100 || light2.Snapshot().Brightness == 100 {
+		t.Error("the action did not apply to the lights of the group only")
+	}
+	if s := state(); s.AnyOn || s.AllOn {
+		t.Errorf("state = %+v with the lights off", s)
+	}
+
+	serve(h, "PUT", "/api/owner/groups/0/action", `{"on":true}`, "")
+	if !light1.Snapshot().On || !light2.Snapshot().On {
+		t.Error("group 0 did not turn every light on")
+	}
+	if s := state(); !s.AnyOn || !s.AllOn {
+		t.Errorf("state = %+v with the lights on", s)
+	}
+
+	// Color temperatures are checked against the full v1 range
+	rec = serve(h, "PUT", "/api/owner/groups/1/action", `{"ct":153}`, "")
+	if rec.Body.String() != `[{"success":{"/groups/1/action/ct":153}}]`+"\n" || light1.Snapshot().ColorTemp != 153 {
+		t.Errorf("ct action = %s", rec.Body)
+	}
+}
@@ -0,0 +1,388 @@
+package hue
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+type HueLight struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	State        *LightState `json:"state"`
+	Type         string      `json:"type"`
+	ModelID      string      `json:"modelid"`
+	Manufacturer string      `json:"manufacturername"`
+	SWVersion    string      `json:"swversion"`
+	UniqueID     string      `json:"uniqueid"`
+	// Capabilities describes what the light model supports
+	Capabilities LightCapabilities `json:"capabilities"`
+
+	// v1ID is the ID of the light in the v1 API
+	v1ID string
+	// deviceID is the ID of the CLIP v2 device owning the light
+	deviceID string
+
+	// transition is the fade in progress towards State, if any
+	transition *transition
+	// alertSeq numbers the alerts, so that only the end of the latest one
+	// resets the alert state
+	alertSeq int
+	// onChange is called after every state change, e.g. to redraw the light window
+	onChange func()
+	// onDelete is called when the light is removed from the bridge
+	onDelete func()
+	// onUpdate is called by the bridge after every change with the previous
+	// state and name, to publish the change on the event stream
+	onUpdate func(before LightState, beforeName string)
+	// mu protects State for concurrent access from HTTP handlers and UI loop
+	mu sync.RWMutex
+}
+
+// Durations of the alert effects, after which the alert state is "none" again
+const (
+	selectAlertDuration  = time.Second
+	lselectAlertDuration = 15 * time.Second
+)
+
+// LightState represents the current state of a Hue light
+type LightState struct {
+	On         bool       `json:"on"`
+	Brightness uint8      `json:"bri"`       // 1-254
+	Hue        uint16     `json:"hue"`       // 0-65535
+	Saturation uint8      `json:"sat"`       // 0-254
+	XY         [2]float64 `json:"xy"`        // CIE 1931 x, y (0-1)
+	ColorTemp  uint16     `json:"ct"`        // 153-500 (mireds)
+	ColorMode  string     `json:"colormode"` // "hs", "ct", "xy"
+	Alert      string     `json:"alert"`
+	Effect     string     `json:"effect"`
+	Reachable  bool       `json:"reachable"`
+}
+
+// LightCapabilities describes the features of a light model
+type LightCapabilities struct {
+	Certified bool         `json:"certified"`
+	Control   LightControl `json:"control"`
+}
+
+// LightControl describes the controllable ranges of a light model
+type LightControl struct {
+	MinDimLevel    int          `json:"mindimlevel"` // in thousandths of a percent
+	MaxLumen       int          `json:"maxlumen"`
+	ColorGamutType string       `json:"colorgamuttype,omitempty"`
+	ColorGamut     [][2]float64 `json:"colorgamut,omitempty"`
+	CT             *CTRange     `json:"ct,omitempty"`
+}
+
+// CTRange is a supported color temperature range in mireds
+type CTRange struct {
+	Min uint16 `json:"min"`
+	Max uint16 `json:"max"`
+}
+
+// capabilitiesForModel returns the capabilities of a light model ID. Unknown
+// models are assumed to be extended color lights.
+func capabilitiesForModel(modelID string) LightCapabilities {
+	g, gamutType := gamutForModel(modelID)
+	caps := LightCapabilities{
+		Certified: true,
+		Control: LightControl{
+			MinDimLevel:    1000,
+			MaxLumen:       800,
+			ColorGamutType: gamutType,
+			ColorGamut: [][2]float64{
+				{g.Red.X, g.Red.Y},
+				{g.Green.X, g.Green.Y},
+				{g.Blue.X, g.Blue.Y},
+			},
+			CT: &CTRange{Min: 153, Max: 500},
+		},
+	}
+	switch {
+	case gamutType == "A":
+		// Gamut A lights (LivingColors, LightStrips) have no white channel
+		caps.Control.MaxLumen = 120
+		caps.Control.CT = nil
+	case strings.HasPrefix(modelID, "LTW"):
+		// White ambiance lights have a narrower range and no color
+		caps.Control.ColorGamutType = ""
+		caps.Control.ColorGamut = nil
+		caps.Control.CT = &CTRange{Min: 153, Max: 454}
+	}
+	return caps
+}
+
+// clampBrightness clamps a v1 brightness to the 1-254 range of the bridge
+func clampBrightness(bri int) uint8 {
+	return uint8(clampInt(bri, 1, 254))
+}
+
+// groupCapabilities are the capabilities group actions are checked against:
+// the full ranges of the v1 API. Each light then clamps the values to its
+// own capabilities.
+var groupCapabilities = LightCapabilities{
+	Control: LightControl{CT: &CTRange{Min: 153, Max: 500}},
+}
+
+// supportsColorTemp reports whether the light has a color temperature range
+func (c LightCapabilities) supportsColorTemp() bool {
+	return c.Control.CT != nil
+}
+
+// clampColorTemp clamps a color temperature to the range of the light, which
+// must support color temperatures.
+func (c LightCapabilities) clampColorTemp(ct int) uint16 {
+	return uint16(clampInt(ct, int(c.Control.CT.Min), int(c.Control.CT.Max)))
+}
+
+// minDimPercent returns the lowest brightness of the light in percent
+func (c LightCapabilities) minDimPercent() float64 {
+	return float64(c.Control.MinDimLevel) / 1000.0
+}
+
+// StateUpdate represents an update to light state
+type StateUpdate struct {
+	On         *bool       `json:"on,omitempty"`
+	Brightness *uint8      `json:"bri,omitempty"`
+	Hue        *uint16     `json:"hue,omitempty"`
+	Saturation *uint8      `json:"sat,omitempty"`
+	ColorTemp  *uint16     `json:"ct,omitempty"`
+	XY         *[2]float64 `json:"xy,omitempty"`
+	Alert      *string     `json:"alert,omitempty"`  // "none", "select", "lselect"
+	Effect     *string     `json:"effect,omitempty"` // "none", "colorloop"
+	// Relative changes, ignored when the matching absolute value is set.
+	// A bri_inc or ct_inc of 0 stops any ongoing transition.
+	BrightnessInc *int16      `json:"bri_inc,omitempty"` // -254-254
+	SaturationInc *int16      `json:"sat_inc,omitempty"` // -254-254
+	HueInc        *int32      `json:"hue_inc,omitempty"` // -65534-65534, wraps around
+	ColorTempInc  *int32      `json:"ct_inc,omitempty"`  // -65534-65534
+	XYInc         *[2]float64 `json:"xy_inc,omitempty"`  // -0.5-0.5
+	// TransitionTime is the fade duration in deciseconds (default 4)
+	TransitionTime *uint16 `json:"transitiontime,omitempty"`
+}
+
+// MarshalJSON encodes the light in its v1 representation, reading Name and
+// State under lock so it can be served while the light is being updated.
+func (l *HueLight) MarshalJSON() ([]byte, error) {
+	type v1Light HueLight
+	l.mu.RLock()
+	name := l.Name
+	state := *l.State
+	l.mu.RUnlock()
+	return json.Marshal(&struct {
+		*v1Light
+		Name  string      `json:"name"`
+		State *LightState `json:"state"`
+	}{(*v1Light)(l), name, &state})
+}
+
+// DisplayName returns the name of the light under read lock
+func (l *HueLight) DisplayName() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.Name
+}
+
+// rename changes the name of the light
+func (l *HueLight) rename(name string) {
+	l.mu.Lock()
+	before, beforeName := *l.State, l.Name
+	l.Name = name
+	onChange, onUpdate := l.onChange, l.onUpdate
+	l.mu.Unlock()
+
+	if onChange != nil {
+		onChange()
+	}
+	if onUpdate != nil {
+		onUpdate(before, beforeName)
+	}
+}
+
+// SetOnChange registers fn to be called after every state change of the
+// light. It replaces any previously registered function.
+func (l *HueLight) SetOnChange(fn func()) {
+	l.mu.Lock()
+	l.onChange = fn
+	l.mu.Unlock()
+}
+
+// SetOnDelete registers fn to be called when the light is deleted from the
+// bridge, e.g. to close the light window. It replaces any previously
+// registered function.
+func (l *HueLight) SetOnDelete(fn func()) {
+	l.mu.Lock()
+	l.onDelete = fn
+	l.mu.Unlock()
+}
+
+// gamut returns the color gamut of the light and its letter
+func (l *HueLight) gamut() (gamut, string) {
+	return gamutForModel(l.ModelID)
+}
+
+// updateLightState updates light state from API call. Like the real bridge,
+// when conflicting color attributes are sent xy wins over ct, and ct over
+// hue/sat; the other color representations are kept in sync with the
+// resulting color. The new state is reported right away while the light
+// fades towards it over the requested transition time.
+func (l *HueLight) updateLightState(update StateUpdate) {
+	g, _ := l.gamut()
+	now := time.Now()
+
+	l.mu.Lock()
+	before := *l.State
+	from := l.renderedLocked(now)
+	if (update.BrightnessInc != nil && *update.BrightnessInc == 0) ||
+		(update.ColorTempInc != nil && *update.ColorTempInc == 0) {
+		// Stop the light where it currently is
+		*l.State = from
+		from = *l.State
+	}
+	if update.On != nil {
+		l.State.On = *update.On
+	}
+	if update.Alert != nil {
+		l.State.Alert = *update.Alert
+		l.scheduleAlertEndLocked()
+	}
+	if update.Effect != nil {
+		l.State.Effect = *update.Effect
+	}
+	if update.Brightness != nil {
+		l.State.Brightness = clampBrightness(int(*update.Brightness))
+	} else if update.BrightnessInc != nil {
+		l.State.Brightness = clampBrightness(int(l.State.Brightness) + int(*update.BrightnessInc))
+	}
+	if update.Hue != nil || update.Saturation != nil || update.HueInc != nil || update.SaturationInc != nil {
+		if update.Hue != nil {
+			l.State.Hue = *update.Hue
+		} else if update.HueInc != nil {
+			l.State.Hue = uint16((int(l.State.Hue) + int(*update.HueInc)) & 0xFFFF)
+		}
+		if update.Saturation != nil {
+			l.State.Saturation = *update.Saturation
+		} else if update.SaturationInc != nil {
+			l.State.Saturation = uint8(clampInt(int(l.State.Saturation)+int(*update.SaturationInc), 0, 254))
+		}
+		x, y := hueSatToXY(l.State.Hue, l.State.Saturation, g)
+		l.State.XY = [2]float64{x, y}
+		l.State.ColorMode = "hs"
+	}
+	// Lights without color temperature support ignore it, e.g. in group actions
+	if (update.ColorTemp != nil || update.ColorTempInc != nil) && l.Capabilities.supportsColorTemp() {
+		if update.ColorTemp != nil {
+			l.State.ColorTemp = l.Capabilities.clampColorTemp(int(*update.ColorTemp))
+		} else {
+			l.State.ColorTemp = l.Capabilities.clampColorTemp(int(l.State.ColorTemp) + int(*update.ColorTempInc))
+		}
+		x, y := ctToXY(l.State.ColorTemp)
+		l.State.XY = [2]float64{x, y}
+		l.State.Hue, l.State.Saturation = xyToHueSat(x, y)
+		l.State.ColorMode = "ct"
+	}
+	if update.XY != nil || update.XYInc != nil {
+		p := xyPoint{l.State.XY[0], l.State.XY[1]}
+		if update.XY != nil {
+			p = xyPoint{update.XY[0], update.XY[1]}
+		} else {
+			p = xyPoint{p.X + update.XYInc[0], p.Y + update.XYInc[1]}
+		}
+		p = xyPoint{math.Max(0, math.Min(1, p.X)), math.Max(0, math.Min(1, p.Y))}
+		p = g.clamp(p)
+		l.State.XY = [2]float64{round4(p.X), round4(p.Y)}
+		l.State.Hue, l.State.Saturation = xyToHueSat(p.X, p.Y)
+		l.State.ColorMode = "xy"
+	}
+	l.transition = newTransition(from, *l.State, now, transitionDuration(update.TransitionTime))
+	onChange, onUpdate, name := l.onChange, l.onUpdate, l.Name
+	l.mu.Unlock()
+
+	// Trigger redraw if a listener is attached
+	if onChange != nil {
+		onChange()
+	}
+	if onUpdate != nil {
+		onUpdate(before, name)
+	}
+}
+
+// scheduleAlertEndLocked resets the alert of the light to "none" once it
+// is over, like the bridge does: a select alert is a single breathe cycle
+// and an lselect alert breathes for 15 seconds. l.mu must be held.
+func (l *HueLight) scheduleAlertEndLocked() {
+	l.alertSeq++
+	var d time.Duration
+	switch l.State.Alert {
+	case "select":
+		d = selectAlertDuration
+	case "lselect":
+		d = lselectAlertDuration
+	default:
+		return
+	}
+	seq := l.alertSeq
+	time.AfterFunc(d, func() { l.endAlert(seq) })
+}
+
+// endAlert resets the alert state of the light if the alert numbered seq
+// is still the latest
+func (l *HueLight) endAlert(seq int) {
+	l.mu.Lock()
+	if l.alertSeq != seq {
+		l.mu.Unlock()
+		return
+	}
+	before := *l.State
+	l.State.Alert = "none"
+	onChange, onUpdate, name := l.onChange, l.onUpdate, l.Name
+	l.mu.Unlock()
+
+	if onChange != nil {
+		onChange()
+	}
+	if onUpdate != nil {
+		onUpdate(before, name)
+	}
+}
+
+// Snapshot returns a copy of the current state under read lock. During a
+// transition this is the target state, as reported by the API.
+func (l *HueLight) Snapshot() LightState {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return *l.State
+}
+
+// Rendered returns the state the light is actually showing, which differs
+// from Snapshot while a transition is in progress, and whether a transition
+// is still running.
+func (l *HueLight) Rendered() (LightState, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.transition == nil {
+		return *l.State, false
+	}
+	return l.transition.at(time.Now())
+}
+
+// renderedLocked returns the state shown at the given time; l.mu must be held
+func (l *HueLight) renderedLocked(now time.Time) LightState {
+	if l.transition == nil {
+		return *l.State
+	}
+	s, _ := l.transition.at(now)
+	return s
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,402 @@
+package hue
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxLinks is the maximum number of resources a resource link refers to
+const maxLinks = 64
+
+// ResourceLink is a v1 resource link, which groups the resources an
+// application created for one feature, e.g. the rules and sensors of a
+// dimmer switch setup
+type ResourceLink struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	ClassID     int      `json:"classid"`
+	Owner       string   `json:"owner"`
+	Recycle     bool     `json:"recycle"`
+	Links       []string `json:"links"`
+}
+
+// v1ResourceLinks returns all resource links keyed by their v1 ID
+func (b *HueBridge) v1ResourceLinks() map[string]ResourceLink {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	links := make(map[string]ResourceLink, len(b.resourcelinks))
+	for id, link := range b.resourcelinks {
+		links[id] = *link
+	}
+	return links
+}
+
+// nextResourceLinkIDLocked returns the lowest free resource link ID; b.mu
+// must be held
+func (b *HueBridge) nextResourceLinkIDLocked() string {
+	for n := 1; ; n++ {
+		if _, exists := b.resourcelinks[strconv.Itoa(n)]; !exists {
+			return strconv.Itoa(n)
+		}
+	}
+}
+
+// splitAddress splits a resource address such as "/rules/1" into its
+// collection and ID. It returns false for any other address.
+func splitAddress(address string) (string, string, bool) {
+	parts := strings.Split(address, "/")
+	if len(parts) != 3 || parts[0] != "" || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// resourceExistsLocked returns whether address refers to an existing
+// resource; b.mu must be held
+func (b *HueBridge) resourceExistsLocked(address string) bool {
+	collection, id, ok := splitAddress(address)
+	if !ok {
+		return false
+	}
+	var exists bool
+	switch collection {
+	case "lights":
+		_, exists = b.lights[id]
+	case "groups":
+		_, exists = b.groups[id]
+		exists = exists || id == allLightsGroupID
+	case "scenes":
+		_, exists = b.scenes[id]
+	case "schedules":
+		_, exists = b.schedules[id]
+	case "rules":
+		_, exists = b.rules[id]
+	case "sensors":
+		_, exists = b.sensors[id]
+	case "resourcelinks":
+		_, exists = b.resourcelinks[id]
+	}
+	return exists
+}
+
+// recyclableLocked returns whether the resource at address is flagged to be
+// deleted once no resource link refers to it anymore; b.mu must be held
+func (b *HueBridge) recyclableLocked(address string) bool {
+	collection, id, _ := splitAddress(address)
+	switch collection {
+	case "groups":
+		group, exists := b.groups[id]
+		return exists && group.Recycle
+	case "scenes":
+		scene, exists := b.scenes[id]
+		return exists && scene.Recycle && !b.sceneInUseLocked(id)
+	case "schedules":
+		schedule, exists := b.schedules[id]
+		return exists && schedule.Recycle
+	case "rules":
+		rule, exists := b.rules[id]
+		return exists && rule.Recycle
+	case "sensors":
+		sensor, exists := b.sensors[id]
+		return exists && sensor.Recycle
+	case "resourcelinks":
+		link, exists := b.resourcelinks[id]
+		return exists && link.Recycle
+	}
+	return false
+}
+
+// linkedLocked returns whether a resource link refers to address; b.mu must
+// be held
+func (b *HueBridge) linkedLocked(address string) bool {
+	for _, link := range b.resourcelinks {
+		for _, l := range link.Links {
+			if l == address {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recycleLocked deletes the recyclable resources among addresses that no
+// resource link refers to anymore; b.mu must be held
+func (b *HueBridge) recycleLocked(addresses []string) {
+	for _, address := range addresses {
+		if b.recyclableLocked(address) && !b.linkedLocked(address) {
+			log.Printf("Recycling %s", address)
+			b.deleteResourceLocked(address)
+		}
+	}
+}
+
+// deleteResourceLocked deletes the resource at address, such as "/rules/1",
+// removes it from the resource links and recycles the resources it linked
+// to. Lights are deleted with DeleteLight. It returns false if there is no
+// such resource. b.mu must be held.
+func (b *HueBridge) deleteResourceLocked(address string) bool {
+	if !b.resourceExistsLocked(address) {
+		return false
+	}
+	collection, id, _ := splitAddress(address)
+	var recycled []string
+	switch collection {
+	case "groups":
+		// Group scenes go along with their group
+		for sceneID, scene := range b.scenes {
+			if scene.Type == sceneTypeGroup && scene.Group == id {
+				b.publishSceneDeleteLocked(scene)
+				scene.stopDynamicLocked()
+				delete(b.scenes, sceneID)
+				b.unlinkLocked("/scenes/" + sceneID)
+			}
+		}
+		b.publishGroupLocked(eventDelete, id, b.groups[id])
+		delete(b.groups, id)
+	case "scenes":
+		b.publishSceneDeleteLocked(b.scenes[id])
+		b.scenes[id].stopDynamicLocked()
+		delete(b.scenes, id)
+	case "schedules":
+		delete(b.schedules, id)
+	case "rules":
+		delete(b.rules, id)
+	case "sensors":
+		delete(b.sensors, id)
+	case "resourcelinks":
+		recycled = b.resourcelinks[id].Links
+		delete(b.resourcelinks, id)
+	default:
+		return false
+	}
+	b.unlinkLocked(address)
+	b.recycleLocked(recycled)
+	return true
+}
+
+// unlinkLocked removes address from every resource link; b.mu must be held
+func (b *HueBridge) unlinkLocked(address string) {
+	for _, link := range b.resourcelinks {
+		for i, l := range link.Links {
+			if l == address {
+				link.Links = append(link.Links[:i:i], link.Links[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func handleGetResourceLinks(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.v1ResourceLinks())
+}
+
+func handleGetResourceLink(w http.ResponseWriter, _ *http.Request, linkID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	link, exists := bridge.resourcelinks[linkID]
+	var v ResourceLink
+	if exists {
+		v = *link
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/resourcelinks/"+linkID, "/resourcelinks/"+linkID)})
+		return
+	}
+	writeJSON(w, v)
+}
+
+// parseResourceLinkAttribute decodes a resource link attribute into link. It
+// returns the value to report, or the v1 error type if the attribute is
+// invalid. Whether the links exist is checked by checkLinksLocked.
+func parseResourceLinkAttribute(link *ResourceLink, name string, raw json.RawMessage) (interface{}, int) {
+	switch name {
+	case "name":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || v == "" || len(v) > 32 {
+			return nil, errInvalidValue
+		}
+		link.Name = v
+		return v, 0
+	case "description":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || len(v) > 64 {
+			return nil, errInvalidValue
+		}
+		link.Description = v
+		return v, 0
+	case "type":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || v != "Link" {
+			return nil, errInvalidValue
+		}
+		link.Type = v
+		return v, 0
+	case "classid":
+		var v int
+		if json.Unmarshal(raw, &v) != nil || v < 1 || v > 65535 {
+			return nil, errInvalidValue
+		}
+		link.ClassID = v
+		return v, 0
+	case "recycle":
+		var v bool
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		link.Recycle = v
+		return v, 0
+	case "links":
+		var v []string
+		if json.Unmarshal(raw, &v) != nil || v == nil {
+			return nil, errInvalidValue
+		}
+		if len(v) > maxLinks {
+			return nil, errTooManyItems
+		}
+		for _, address := range v {
+			if _, _, ok := splitAddress(address); !ok {
+				return nil, errInvalidValue
+			}
+		}
+		link.Links = v
+		return v, 0
+	}
+	return nil, errParameterNotAvailable
+}
+
+// checkLinksLocked returns the error entry for the first link of links that
+// does not exist, or nil; b.mu must be held
+func (b *HueBridge) checkLinksLocked(links []string, address string) map[string]interface{} {
+	for _, l := range links {
+		if !b.resourceExistsLocked(l) {
+			return newAPIError(errResourceNotAvailable, address, l)
+		}
+	}
+	return nil
+}
+
+// resourceLinkError builds the error entry of an invalid resource link
+// attribute
+func resourceLinkError(errType int, address, name string, raw json.RawMessage) map[string]interface{} {
+	switch errType {
+	case errInvalidValue:
+		return newAPIError(errInvalidValue, address, rawValue(raw), name)
+	case errParameterNotAvailable, errParameterNotModifiable:
+		return newAPIError(errType, address, name)
+	}
+	return newAPIError(errType, address)
+}
+
+// handleCreateResourceLink handles POST /resourcelinks. The name, class ID
+// and links are required, and every link must exist.
+func handleCreateResourceLink(w http.ResponseWriter, r *http.Request, owner string, bridge *HueBridge) {
+	body, ok := decodeBody(w, r, "/resourcelinks")
+	if !ok {
+		return
+	}
+	for _, attr := range []string{"name", "classid", "links"} {
+		if _, exists := body[attr]; !exists {
+			writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/resourcelinks")})
+			return
+		}
+	}
+
+	link := &ResourceLink{Type: "Link", Owner: owner}
+	var errors []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		if _, errType := parseResourceLinkAttribute(link, attr, raw); errType != 0 {
+			errors = append(errors, resourceLinkError(errType, "/resourcelinks/"+attr, attr, raw))
+		}
+	}
+	if len(errors) > 0 {
+		writeJSON(w, errors)
+		return
+	}
+
+	bridge.mu.Lock()
+	if len(bridge.resourcelinks) >= bridge.limits.ResourceLinks {
+		bridge.mu.Unlock()
+		writeJSON(w, []interface{}{newAPIError(errResourceLinkTableFull, "/resourcelinks")})
+		return
+	}
+	if err := bridge.checkLinksLocked(link.Links, "/resourcelinks/links"); err != nil {
+		bridge.mu.Unlock()
+		writeJSON(w, []interface{}{err})
+		return
+	}
+	id := bridge.nextResourceLinkIDLocked()
+	bridge.resourcelinks[id] = link
+	bridge.mu.Unlock()
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"id": id}}})
+
+	log.Printf("Resource link %s created: %q", id, link.Name)
+}
+
+// handleUpdateResourceLink handles PUT /resourcelinks/<id>. Resources no
+// longer linked are recycled.
+func handleUpdateResourceLink(w http.ResponseWriter, r *http.Request, linkID string, bridge *HueBridge) {
+	address := "/resourcelinks/" + linkID
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	link, exists := bridge.resourcelinks[linkID]
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+
+	previous := link.Links
+	var responses []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		attrAddress := address + "/" + attr
+		if attr == "owner" {
+			responses = append(responses, newAPIError(errParameterNotModifiable, attrAddress, attr))
+			continue
+		}
+		updated := *link
+		value, errType := parseResourceLinkAttribute(&updated, attr, raw)
+		if errType != 0 {
+			responses = append(responses, resourceLinkError(errType, attrAddress, attr, raw))
+			continue
+		}
+		if attr == "links" {
+			if err := bridge.checkLinksLocked(updated.Links, attrAddress); err != nil {
+				responses = append(responses, err)
+				continue
+			}
+		}
+		*link = updated
+		responses = append(responses, newSuccess(attrAddress, value))
+	}
+	bridge.recycleLocked(previous)
+
+	writeJSON(w, responses)
+}
+
+func handleDeleteResourceLink(w http.ResponseWriter, _ *http.Request, linkID string, bridge *HueBridge) {
+	address := "/resourcelinks/" + linkID
+
+	bridge.mu.Lock()
+	exists := bridge.deleteResourceLocked(address)
+	bridge.mu.Unlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+	writeJSON(w, []interface{}{map[string]interface{}{"success": address + " deleted"}})
+
+	log.Printf("Resource link %s deleted", linkID)
+}
@@ -0,0 +1,147 @@
+package hue
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testResource describes a resource to add to a bridge
+type testResource struct {
+	address string
+	recycle bool
+	// links are the addresses linked by a resource link
+	links []string
+	// scene is the scene recalled by a schedule, or the group of a scene
+	scene, group string
+}
+
+// addTestResource adds r to the bridge; b.mu must be held
+func addTestResource(b *HueBridge, r testResource) {
+	collection, id, _ := splitAddress(r.address)
+	switch collection {
+	case "groups":
+		b.groups[id] = &Group{Name: id, Type: "LightGroup", Recycle: r.recycle}
+	case "scenes":
+		scene := newScene(sceneTypeGroup, "owner")
+		scene.Group, scene.Recycle = r.group, r.recycle
+		b.scenes[id] = scene
+	case "schedules":
+		command := Command{Address: "/api/owner/groups/0/action", Method: "PUT", Body: map[string]interface{}{"scene": r.scene}}
+		b.schedules[id] = &Schedule{Name: id, Command: command, Recycle: r.recycle}
+	case "rules":
+		b.rules[id] = &Rule{Name: id, Recycle: r.recycle}
+	case "resourcelinks":
+		b.resourcelinks[id] = &ResourceLink{Name: id, Recycle: r.recycle, Links: r.links}
+	}
+}
+
+func TestRecycle(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []testResource
+		delete    string
+		want      []string
+	}{
+		{
+			name: "recyclable resources",
+			resources: []testResource{
+				{address: "/resourcelinks/1", links: []string{"/rules/1", "/schedules/1"}},
+				{address: "/rules/1", recycle: true},
+				{address: "/schedules/1", recycle: true},
+			},
+			delete: "/resourcelinks/1",
+			want:   nil,
+		},
+		{
+			name: "resources kept",
+			resources: []testResource{
+				{address: "/resourcelinks/1", links: []string{"/rules/1", "/rules/2"}},
+				{address: "/rules/1"},
+				{address: "/rules/2", recycle: true},
+				{address: "/resourcelinks/2", links: []string{"/rules/2"}},
+			},
+			delete: "/resourcelinks/1",
+			want:   []string{"/rules/1", "/rules/2", "/resourcelinks/2"},
+		},
+		{
+			name: "scenes of recycled groups",
+			resources: []testResource{
+				{address: "/resourcelinks/1", links: []string{"/groups/1"}},
+				{address: "/groups/1", recycle: true},
+				{address: "/scenes/a", group: "1"},
+				{address: "/scenes/b", group: "2"},
+				{address: "/resourcelinks/2", links: []string{"/scenes/a", "/scenes/b"}},
+			},
+			delete: "/resourcelinks/1",
+			want:   []string{"/scenes/b", "/resourcelinks/2"},
+		},
+		{
+			name: "scene used by a schedule",
+			resources: []testResource{
+				{address: "/resourcelinks/1", links: []string{"/scenes/a", "/scenes/b"}},
+				{address: "/scenes/a", recycle: true},
+				{address: "/scenes/b", recycle: true},
+				{address: "/schedules/1", scene: "a"},
+			},
+			delete: "/resourcelinks/1",
+			want:   []string{"/scenes/a", "/schedules/1"},
+		},
+		{
+			name: "nested resource links",
+			resources: []testResource{
+				{address: "/resourcelinks/1", links: []string{"/resourcelinks/2"}},
+				{address: "/resourcelinks/2", recycle: true, links: []string{"/rules/1"}},
+				{address: "/rules/1", recycle: true},
+			},
+			delete: "/resourcelinks/1",
+			want:   nil,
+		},
+		{
+			name: "deleted resources are unlinked",
+			resources: []testResource{
+				{address: "/resourcelinks/1", links: []string{"/rules/1", "/rules/2"}},
+				{address: "/rules/1", recycle: true},
+				{address: "/rules/2", recycle: true},
+			},
+			delete: "/rules/1",
+			want:   []string{"/resourcelinks/1", "/rules/2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			for _, r := range tt.resources {
+				addTestResource(b, r)
+			}
+			if !b.deleteResourceLocked(tt.delete) {
+				t.Fatalf("%s not deleted", tt.delete)
+			}
+			var got []string
+			for _, r := range tt.resources {
+				if b.resourceExistsLocked(r.address) {
+					got = append(got, r.address)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("remaining resources = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Links to deleted resources go away
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.mu.Lock()
+	addTestResource(b, testResource{address: "/resourcelinks/1", links: []string{"/rules/1", "/rules/2"}})
+	addTestResource(b, testResource{address: "/rules/1"})
+	addTestResource(b, testResource{address: "/rules/2"})
+	b.deleteResourceLocked("/rules/1")
+	links := b.resourcelinks["1"].Links
+	b.mu.Unlock()
+	if !reflect.DeepEqual(links, []string{"/rules/2"}) {
+		t.Errorf("links = %v, want [/rules/2]", links)
+	}
+}
@@ -0,0 +1,418 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// V2Group is a CLIP v2 room or zone. The children of a room are devices,
+// those of a zone are lights.
+type V2Group struct {
+	ID       string          `json:"id"`
+	IDV1     string          `json:"id_v1"`
+	Children []V2ResourceRef `json:"children"`
+	Services []V2ResourceRef `json:"services"`
+	Metadata V2Metadata      `json:"metadata"`
+	Type     string          `json:"type"`
+}
+
+// V2GroupedLight controls all the lights of a room or zone at once
+type V2GroupedLight struct {
+	ID      string        `json:"id"`
+	IDV1    string        `json:"id_v1"`
+	Owner   V2ResourceRef `json:"owner"`
+	On      V2OnState     `json:"on"`
+	Dimming V2Dimming     `json:"dimming"`
+	Type    string        `json:"type"`
+}
+
+// v2GroupTypes maps the v1 group types exposed in CLIP v2 to their v2 type
+var v2GroupTypes = map[string]string{
+	groupTypeRoom: "room",
+	groupTypeZone: "zone",
+}
+
+// v1GroupType returns the v1 group type of a v2 room or zone type
+func v1GroupType(v2Type string) string {
+	for v1Type, t := range v2GroupTypes {
+		if t == v2Type {
+			return v1Type
+		}
+	}
+	return ""
+}
+
+// classArchetype returns the v2 archetype of a v1 room class, e.g.
+// "living_room" for "Living room"
+func classArchetype(class string) string {
+	return strings.ReplaceAll(strings.ToLower(class), " ", "_")
+}
+
+// archetypeClass returns the v1 room class of a v2 archetype
+func archetypeClass(archetype string) (string, bool) {
+	for class := range roomClasses {
+		if classArchetype(class) == archetype {
+			return class, true
+		}
+	}
+	return "", false
+}
+
+// convertToV2GroupLocked returns the v2 room or zone of a group; b.mu must
+// be held
+func (b *HueBridge) convertToV2GroupLocked(id string, group *Group) V2Group {
+	v2Type := v2GroupTypes[group.Type]
+	children := []V2ResourceRef{}
+	for _, lightID := range group.Lights {
+		light, exists := b.lights[lightID]
+		switch {
+		case !exists:
+		case v2Type == "room":
+			children = append(children, V2ResourceRef{RID: light.deviceID, RType: "device"})
+		default:
+			children = append(children, V2ResourceRef{RID: light.ID, RType: "light"})
+		}
+	}
+	return V2Group{
+		ID:       group.v2ID,
+		IDV1:     "/groups/" + id,
+		Children: children,
+		Services: []V2ResourceRef{{RID: group.groupedLightID, RType: "grouped_light"}},
+		Metadata: V2Metadata{Name: group.Name, Archetype: classArchetype(group.Class)},
+		Type:     v2Type,
+	}
+}
+
+// convertToV2GroupedLightLocked returns the grouped light of a group: on if
+// any light is on, at the average brightness of the lights that are on.
+// b.mu must be held.
+func (b *HueBridge) convertToV2GroupedLightLocked(id string, group *Group) V2GroupedLight {
+	groupedLight := V2GroupedLight{
+		ID:    group.groupedLightID,
+		IDV1:  "/groups/" + id,
+		Owner: V2ResourceRef{RID: group.v2ID, RType: v2GroupTypes[group.Type]},
+		Type:  "grouped_light",
+	}
+	on, brightness := 0, 0.0
+	for _, lightID := range group.Lights {
+		if light, exists := b.lights[lightID]; exists {
+			if state := light.Snapshot(); state.On {
+				on++
+				brightness += float64(state.Brightness) / 254.0 * 100.0
+			}
+		}
+	}
+	if on > 0 {
+		groupedLight.On.On = true
+		groupedLight.Dimming.Brightness = brightness / float64(on)
+	}
+	return groupedLight
+}
+
+// v2GroupIDsLocked returns the v1 IDs of the groups exposed in CLIP v2 in
+// numerical order; b.mu must be held
+func (b *HueBridge) v2GroupIDsLocked() []string {
+	ids := make([]string, 0, len(b.groups))
+	for id, group := range b.groups {
+		if v2GroupTypes[group.Type] != "" {
+			ids = append(ids, id)
+		}
+	}
+	sortIDs(ids)
+	return ids
+}
+
+// groupByV2IDLocked finds a room or zone by its v2 ID, or by the ID of its
+// grouped light; b.mu must be held
+func (b *HueBridge) groupByV2IDLocked(v2Type, v2ID string) (string, *Group, bool) {
+	for id, group := range b.groups {
+		if v2GroupTypes[group.Type] == "" {
+			continue
+		}
+		if (v2Type == "grouped_light" && group.groupedLightID == v2ID) ||
+			(v2GroupTypes[group.Type] == v2Type && group.v2ID == v2ID) {
+			return id, group, true
+		}
+	}
+	return "", nil, false
+}
+
+// publishGroupedLightsOf publishes the grouped lights of the rooms and zones
+// holding the light with the given v1 ID
+func (b *HueBridge) publishGroupedLightsOf(lightID string) {
+	b.mu.RLock()
+	var groupedLights []V2GroupedLight
+	for _, id := range b.v2GroupIDsLocked() {
+		if group := b.groups[id]; containsLight(group, lightID) {
+			groupedLights = append(groupedLights, b.convertToV2GroupedLightLocked(id, group))
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, groupedLight := range groupedLights {
+		b.events.publish(eventUpdate, map[string]interface{}{
+			"id":      groupedLight.ID,
+			"id_v1":   groupedLight.IDV1,
+			"type":    groupedLight.Type,
+			"on":      groupedLight.On,
+			"dimming": map[string]float64{"brightness": groupedLight.Dimming.Brightness},
+		})
+	}
+}
+
+// publishGroupLocked publishes the creation, change or deletion of the room
+// or zone of a group and of its grouped light. Other groups are not part of
+// CLIP v2. b.mu must be held.
+func (b *HueBridge) publishGroupLocked(eventType, id string, group *Group) {
+	v2Type := v2GroupTypes[group.Type]
+	if v2Type == "" {
+		return
+	}
+	if eventType == eventDelete {
+		b.events.publish(eventDelete, map[string]string{"id": group.v2ID, "id_v1": "/groups/" + id, "type": v2Type})
+		b.events.publish(eventDelete, map[string]string{"id": group.groupedLightID, "id_v1": "/groups/" + id, "type": "grouped_light"})
+		return
+	}
+	b.events.publish(eventType, b.convertToV2GroupLocked(id, group))
+	b.events.publish(eventType, b.convertToV2GroupedLightLocked(id, group))
+}
+
+// containsLight reports whether group holds the light with the given v1 ID
+func containsLight(group *Group, lightID string) bool {
+	for _, id := range group.Lights {
+		if id == lightID {
+			return true
+		}
+	}
+	return false
+}
+
+// v2GroupBody is the body of POST and PUT requests on rooms and zones
+type v2GroupBody struct {
+	Metadata *struct {
+		Name      *string `json:"name"`
+		Archetype *string `json:"archetype"`
+	} `json:"metadata"`
+	Children *[]V2ResourceRef `json:"children"`
+}
+
+// applyLocked applies the body to a group of the given v2 type, checking
+// the children like the v1 API checks lights. It returns a description of
+// the first invalid attribute. b.mu must be held.
+func (body v2GroupBody) applyLocked(b *HueBridge, v2Type, groupID string, group *Group) (string, bool) {
+	if body.Metadata != nil && body.Metadata.Name != nil {
+		name := *body.Metadata.Name
+		if name == "" || len(name) > 32 {
+			return "invalid value for metadata.name", false
+		}
+		group.Name = name
+	}
+	if body.Metadata != nil && body.Metadata.Archetype != nil {
+		class, ok := archetypeClass(*body.Metadata.Archetype)
+		if !ok {
+			return fmt.Sprintf("invalid archetype %q", *body.Metadata.Archetype), false
+		}
+		group.Class = class
+	}
+	if body.Children == nil {
+		return "", true
+	}
+
+	ids := make([]string, 0, len(*body.Children))
+	for _, child := range *body.Children {
+		var light *HueLight
+		var exists bool
+		switch {
+		case v2Type == "room" && child.RType == "device":
+			light, exists = b.lightByDeviceIDLocked(child.RID)
+		case v2Type == "zone" && child.RType == "light":
+			light, exists = b.lightByAnyIDLocked(child.RID)
+		}
+		if !exists {
+			return fmt.Sprintf("invalid child %s %s", child.RType, child.RID), false
+		}
+		ids = append(ids, light.v1ID)
+	}
+	raw, _ := json.Marshal(ids)
+	lights, apiErr := b.checkGroupLightsLocked(groupID, group.Type, raw, "/groups/"+groupID+"/lights")
+	if apiErr != nil {
+		return apiErr["error"].(apiError).Description, false
+	}
+	group.Lights = lights
+	return "", true
+}
+
+func handleGetV2Groups(w http.ResponseWriter, _ *http.Request, v2Type string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	groups := []V2Group{}
+	for _, id := range bridge.v2GroupIDsLocked() {
+		if group := bridge.groups[id]; v2GroupTypes[group.Type] == v2Type {
+			groups = append(groups, bridge.convertToV2GroupLocked(id, group))
+		}
+	}
+	bridge.mu.RUnlock()
+	writeV2Data(w, groups)
+}
+
+func handleGetV2Group(w http.ResponseWriter, _ *http.Request, v2Type, v2ID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	id, group, exists := bridge.groupByV2IDLocked(v2Type, v2ID)
+	var v V2Group
+	if exists {
+		v = bridge.convertToV2GroupLocked(id, group)
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeV2Data(w, []V2Group{v})
+}
+
+// handleCreateV2Group handles POST /clip/v2/resource/room and zone, which
+// create a v1 Room or Zone group
+func handleCreateV2Group(w http.ResponseWriter, r *http.Request, v2Type string, bridge *HueBridge) {
+	var body v2GroupBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeV2Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if body.Metadata == nil || body.Metadata.Name == nil {
+		writeV2Error(w, http.StatusBadRequest, "metadata.name is required")
+		return
+	}
+
+	bridge.mu.Lock()
+	if len(bridge.groups) >= bridge.limits.Groups {
+		bridge.mu.Unlock()
+		writeV2LimitError(w, v2Type, bridge.limits.Groups)
+		return
+	}
+	id := bridge.nextGroupIDLocked()
+	group := &Group{
+		Lights:         []string{},
+		Sensors:        []string{},
+		Type:           v1GroupType(v2Type),
+		Class:          "Other",
+		v2ID:           uuid.New().String(),
+		groupedLightID: uuid.New().String(),
+	}
+	if description, ok := body.applyLocked(bridge, v2Type, id, group); !ok {
+		bridge.mu.Unlock()
+		writeV2Error(w, http.StatusBadRequest, description)
+		return
+	}
+	bridge.groups[id] = group
+	bridge.publishGroupLocked(eventAdd, id, group)
+	bridge.mu.Unlock()
+
+	writeV2Data(w, []V2ResourceRef{{RID: group.v2ID, RType: v2Type}})
+
+	log.Printf("V2 %s %s created as group %s: %q with lights %v", v2Type, group.v2ID, id, group.Name, group.Lights)
+}
+
+// handleUpdateV2Group handles PUT /clip/v2/resource/room/{id} and zone,
+// which rename the group, change its archetype or replace its children
+func handleUpdateV2Group(w http.ResponseWriter, r *http.Request, v2Type, v2ID string, bridge *HueBridge) {
+	var body v2GroupBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeV2Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	id, group, exists := bridge.groupByV2IDLocked(v2Type, v2ID)
+	if !exists {
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	// Apply to a copy so that an invalid attribute changes nothing
+	updated := *group
+	if description, ok := body.applyLocked(bridge, v2Type, id, &updated); !ok {
+		writeV2Error(w, http.StatusBadRequest, description)
+		return
+	}
+	*group = updated
+	bridge.publishGroupLocked(eventUpdate, id, group)
+
+	writeV2Data(w, []V2ResourceRef{{RID: v2ID, RType: v2Type}})
+}
+
+func handleDeleteV2Group(w http.ResponseWriter, _ *http.Request, v2Type, v2ID string, bridge *HueBridge) {
+	bridge.mu.Lock()
+	id, _, exists := bridge.groupByV2IDLocked(v2Type, v2ID)
+	if exists {
+		bridge.deleteResourceLocked("/groups/" + id)
+	}
+	bridge.mu.Unlock()
+
+	if !exists {
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeV2Data(w, []V2ResourceRef{{RID: v2ID, RType: v2Type}})
+
+	log.Printf("V2 %s %s deleted", v2Type, v2ID)
+}
+
+func handleGetV2GroupedLights(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	bridge.mu.RLock()
+	groupedLights := []V2GroupedLight{}
+	for _, id := range bridge.v2GroupIDsLocked() {
+		groupedLights = append(groupedLights, bridge.convertToV2GroupedLightLocked(id, bridge.groups[id]))
+	}
+	bridge.mu.RUnlock()
+	writeV2Data(w, groupedLights)
+}
+
+func handleGetV2GroupedLight(w http.ResponseWriter, _ *http.Request, v2ID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	id, group, exists := bridge.groupByV2IDLocked("grouped_light", v2ID)
+	var v V2GroupedLight
+	if exists {
+		v = bridge.convertToV2GroupedLightLocked(id, group)
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeV2Data(w, []V2GroupedLight{v})
+}
+
+// handleUpdateV2GroupedLight handles PUT /clip/v2/resource/grouped_light/{id},
+// which applies the update to every light of the room or zone, each
+// clamping it to its own capabilities
+func handleUpdateV2GroupedLight(w http.ResponseWriter, r *http.Request, v2ID string, bridge *HueBridge) {
+	var update map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeV2Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	bridge.mu.RLock()
+	id, _, exists := bridge.groupByV2IDLocked("grouped_light", v2ID)
+	bridge.mu.RUnlock()
+	if !exists {
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	lights, _ := bridge.groupLights(id)
+	bridge.lightsChanged(lights)
+	for _, light := range lights {
+		light.updateLightState(convertV2ToV1StateUpdate(update, light.Capabilities))
+	}
+
+	writeV2Data(w, []V2ResourceRef{{RID: v2ID, RType: "grouped_light"}})
+
+	log.Printf("V2 Grouped light %s updated via CLIP API", v2ID)
+}
@@ -0,0 +1,94 @@
+package hue
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGroupEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   []string
+	}{
+		{
+			name:   "v1 group lights",
+			method: "PUT", path: "/api/owner/groups/1", body: `{"lights":["1"]}`,
+			want: []string{"update grouped_light", "update room"},
+		},
+		{
+			name:   "v1 group name",
+			method: "PUT", path: "/api/owner/groups/1", body: `{"name":"Kitchen"}`,
+			want: []string{"update grouped_light", "update room"},
+		},
+		{
+			name:   "v1 light group",
+			method: "POST", path: "/api/owner/groups", body: `{"name":"Group","lights":["1"]}`,
+			want: nil,
+		},
+		{
+			name:   "v2 zone",
+			method: "POST", path: "/clip/v2/resource/zone", body: `{"metadata":{"name":"Zone"}}`,
+			want: []string{"add grouped_light", "add zone"},
+		},
+		{
+			name:   "group deleted",
+			method: "DELETE", path: "/api/owner/groups/1",
+			want: []string{"delete grouped_light", "delete room", "delete scene"},
+		},
+		{
+			name:   "light state",
+			method: "PUT", path: "/api/owner/lights/1/state", body: `{"on":true}`,
+			want: []string{"update grouped_light", "update light"},
+		},
+		{
+			name:   "light deleted",
+			method: "DELETE", path: "/api/owner/lights/2",
+			want: []string{"delete device", "delete light", "update grouped_light", "update room", "update scene"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#rooms")
+			b.CreateLight(1)
+			b.CreateLight(2)
+			h := b.Handler()
+			for _, setup := range []struct{ path, body string }{
+				{"/api/owner/groups", `{"name":"Room","type":"Room","lights":["1","2"]}`},
+				{"/api/owner/scenes", `{"name":"Scene","type":"GroupScene","group":"1"}`},
+			} {
+				if rec := serve(h, "POST", setup.path, setup.body, ""); !strings.Contains(rec.Body.String(), "success") {
+					t.Fatalf("POST %s = %s", setup.path, rec.Body)
+				}
+			}
+
+			ch := b.events.subscribe()
+			defer b.events.unsubscribe(ch)
+			rec := serve(h, tt.method, tt.path, tt.body, "owner")
+			if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"error":`) {
+				t.Fatalf("%s %s = %d %s", tt.method, tt.path, rec.Code, rec.Body)
+			}
+			b.events.flush()
+			var got []string
+			for len(ch) > 0 {
+				_, _, events := receiveEvents(t, ch)
+				for _, e := range events {
+					for _, data := range e.Data {
+						got = append(got, fmt.Sprintf("%s %s", e.Type, data.(map[string]interface{})["type"]))
+					}
+				}
+			}
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
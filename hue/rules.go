@@ -0,0 +1,511 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule statuses
+const (
+	ruleEnabled  = "enabled"
+	ruleDisabled = "disabled"
+)
+
+// maxRulePasses bounds how many times rules are evaluated in a row when the
+// actions of rules trigger other rules
+const maxRulePasses = 10
+
+// Rule is a v1 rule, running actions when all its conditions become true
+type Rule struct {
+	Name           string          `json:"name"`
+	Owner          string          `json:"owner"`
+	Created        string          `json:"created"`
+	LastTriggered  string          `json:"lasttriggered"`
+	TimesTriggered int             `json:"timestriggered"`
+	Status         string          `json:"status"`
+	Recycle        bool            `json:"recycle"`
+	Conditions     []RuleCondition `json:"conditions"`
+	// Actions are run on behalf of the owner, their addresses are relative
+	// to /api/<owner>
+	Actions []Command `json:"actions"`
+}
+
+// RuleCondition is a condition on the value at a resource address
+type RuleCondition struct {
+	Address  string `json:"address"` // e.g. /sensors/2/state/buttonevent
+	Operator string `json:"operator"`
+	Value    string `json:"value,omitempty"`
+}
+
+// addressState tracks the changes of a value used by rule conditions
+type addressState struct {
+	value interface{}
+	// changed is when the value last changed, or was first seen
+	changed time.Time
+	// dx is set during the evaluation in which the value changed
+	dx bool
+	// observed is set once the value has changed at least once
+	observed bool
+}
+
+// timeIntervalPattern is the value of in and not in conditions, e.g.
+// T08:00:00/T12:00:00 or W124/T08:00:00/T12:00:00
+var timeIntervalPattern = regexp.MustCompile(`^(?:W(\d{1,3})/)?T(\d{2}):(\d{2}):(\d{2})/T(\d{2}):(\d{2}):(\d{2})$`)
+
+// checkCondition reports whether c is a valid condition on an existing
+// address of the bridge
+func (b *HueBridge) checkCondition(c RuleCondition) bool {
+	if _, ok := b.resolveAddress(c.Address); !ok {
+		return false
+	}
+	switch c.Operator {
+	case "eq":
+		return c.Value != ""
+	case "gt", "lt":
+		_, err := strconv.ParseFloat(c.Value, 64)
+		return err == nil
+	case "dx":
+		return c.Value == ""
+	case "ddx", "stable", "not stable":
+		_, ok := parseRuleDuration(c.Value)
+		return ok
+	case "in", "not in":
+		return c.Address == "/config/localtime" && timeIntervalPattern.MatchString(c.Value)
+	}
+	return false
+}
+
+// parseRuleDuration parses the PT[hh]:[mm]:[ss] value of time conditions
+func parseRuleDuration(value string) (time.Duration, bool) {
+	p, ok := parseTimePattern(value)
+	if !ok || p.kind != patternTimer || p.repeat != 1 || p.random != 0 {
+		return 0, false
+	}
+	return p.timeOfDay, true
+}
+
+// checkRuleAction reports whether a is a valid rule action
+func checkRuleAction(a Command) bool {
+	if !strings.HasPrefix(a.Address, "/") || strings.HasPrefix(a.Address, "/api/") {
+		return false
+	}
+	switch a.Method {
+	case "PUT", "POST", "DELETE":
+		return true
+	}
+	return false
+}
+
+// evaluate reports whether condition c holds for the tracked state of its
+// address at the given time
+func (c RuleCondition) evaluate(state *addressState, now time.Time, loc *time.Location) bool {
+	if state == nil {
+		return false
+	}
+	switch c.Operator {
+	case "eq":
+		switch v := state.value.(type) {
+		case bool:
+			return strconv.FormatBool(v) == c.Value
+		case float64:
+			n, err := strconv.ParseFloat(c.Value, 64)
+			return err == nil && v == n
+		default:
+			return fmt.Sprint(v) == c.Value
+		}
+	case "gt", "lt":
+		v, ok := state.value.(float64)
+		n, err := strconv.ParseFloat(c.Value, 64)
+		if !ok || err != nil {
+			return false
+		}
+		return (c.Operator == "gt" && v > n) || (c.Operator == "lt" && v < n)
+	case "dx":
+		return state.dx
+	case "ddx", "stable", "not stable":
+		d, _ := parseRuleDuration(c.Value)
+		stable := !now.Before(state.changed.Add(d))
+		switch c.Operator {
+		case "ddx":
+			return state.observed && stable
+		case "stable":
+			return stable
+		}
+		return !stable
+	case "in", "not in":
+		in := inTimeInterval(c.Value, now.In(loc))
+		return in == (c.Operator == "in")
+	}
+	return false
+}
+
+// inTimeInterval reports whether the local time t is in a time interval of
+// the form [W[bbb]/]T[hh]:[mm]:[ss]/T[hh]:[mm]:[ss], which may span midnight
+func inTimeInterval(interval string, t time.Time) bool {
+	m := timeIntervalPattern.FindStringSubmatch(interval)
+	if m == nil {
+		return false
+	}
+	n := atois(m[2:8])
+	from := time.Duration(n[0])*time.Hour + time.Duration(n[1])*time.Minute + time.Duration(n[2])*time.Second
+	to := time.Duration(n[3])*time.Hour + time.Duration(n[4])*time.Minute + time.Duration(n[5])*time.Second
+	at := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	day := t.Weekday()
+	var in bool
+	if from <= to {
+		in = at >= from && at < to
+	} else {
+		in = at >= from || at < to
+		if at < to {
+			// The interval started the day before
+			day = (day + 6) % 7
+		}
+	}
+	if m[1] != "" {
+		weekdays, _ := strconv.Atoi(m[1])
+		in = in && weekdays&weekdayBit(day) != 0
+	}
+	return in
+}
+
+// evaluateRules evaluates the enabled rules against the current state of
+// the bridge and runs the actions of those whose conditions all became
+// true. It is called after every change and every second, as time
+// conditions depend on the clock.
+func (b *HueBridge) evaluateRules() {
+	b.rulesMu.Lock()
+	defer b.rulesMu.Unlock()
+
+	for pass := 0; pass < maxRulePasses; pass++ {
+		actions := b.evaluateRulesOnce()
+		if len(actions) == 0 {
+			return
+		}
+		for _, action := range actions {
+			b.runCommand(action)
+		}
+	}
+	log.Printf("Rules still triggering after %d passes, giving up", maxRulePasses)
+}
+
+// evaluateRulesOnce updates the tracked values of the addresses used by
+// rules and returns the actions of the rules that triggered.
+// b.rulesMu must be held.
+func (b *HueBridge) evaluateRulesOnce() []Command {
+	now, loc := b.Now(), b.location()
+
+	b.mu.RLock()
+	rules := make(map[string]Rule, len(b.rules))
+	for id, rule := range b.rules {
+		if rule.Status == ruleEnabled {
+			rules[id] = *rule
+		}
+	}
+	b.mu.RUnlock()
+
+	// Track the changes of every address used by a condition
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		for _, c := range rule.Conditions {
+			if seen[c.Address] {
+				continue
+			}
+			seen[c.Address] = true
+			value, ok := b.resolveAddress(c.Address)
+			state, tracked := b.ruleAddresses[c.Address]
+			switch {
+			case !ok:
+				delete(b.ruleAddresses, c.Address)
+			case !tracked:
+				b.ruleAddresses[c.Address] = &addressState{value: value, changed: now}
+			case !reflect.DeepEqual(state.value, value):
+				state.value, state.changed, state.dx, state.observed = value, now, true, true
+			default:
+				state.dx = false
+			}
+		}
+	}
+	for address := range b.ruleAddresses {
+		if !seen[address] {
+			delete(b.ruleAddresses, address)
+		}
+	}
+
+	ids := make([]string, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+
+	var actions []Command
+	var triggered []string
+	for _, id := range ids {
+		rule := rules[id]
+		holds := len(rule.Conditions) > 0
+		for _, c := range rule.Conditions {
+			holds = holds && c.evaluate(b.ruleAddresses[c.Address], now, loc)
+		}
+		// New and re-enabled rules only trigger once their conditions start
+		// to hold
+		if held, known := b.rulesHolding[id]; holds && known && !held {
+			triggered = append(triggered, id)
+			for _, action := range rule.Actions {
+				action.Address = "/api/" + rule.Owner + action.Address
+				actions = append(actions, action)
+			}
+		}
+		b.rulesHolding[id] = holds
+	}
+	for id := range b.rulesHolding {
+		if _, enabled := rules[id]; !enabled {
+			delete(b.rulesHolding, id)
+		}
+	}
+	for _, state := range b.ruleAddresses {
+		// A change is only reported by dx in the evaluation seeing it
+		state.dx = false
+	}
+
+	b.mu.Lock()
+	for _, id := range triggered {
+		if rule, exists := b.rules[id]; exists {
+			rule.LastTriggered = now.UTC().Format(timeLayout)
+			rule.TimesTriggered++
+		}
+		log.Printf("Rule %s triggered", id)
+	}
+	b.mu.Unlock()
+	return actions
+}
+
+// v1Rules returns all rules keyed by their v1 ID
+func (b *HueBridge) v1Rules() map[string]Rule {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	rules := make(map[string]Rule, len(b.rules))
+	for id, rule := range b.rules {
+		rules[id] = *rule
+	}
+	return rules
+}
+
+// nextRuleIDLocked returns the lowest free rule ID; b.mu must be held
+func (b *HueBridge) nextRuleIDLocked() string {
+	for n := 1; ; n++ {
+		if _, exists := b.rules[strconv.Itoa(n)]; !exists {
+			return strconv.Itoa(n)
+		}
+	}
+}
+
+func handleGetRules(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.v1Rules())
+}
+
+func handleGetRule(w http.ResponseWriter, _ *http.Request, ruleID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	rule, exists := bridge.rules[ruleID]
+	var v Rule
+	if exists {
+		v = *rule
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/rules/"+ruleID, "/rules/"+ruleID)})
+		return
+	}
+	writeJSON(w, v)
+}
+
+// parseRuleAttribute decodes a rule attribute into rule. It returns the
+// value to report, or the v1 error type if the attribute is invalid.
+func (b *HueBridge) parseRuleAttribute(rule *Rule, name string, raw json.RawMessage) (interface{}, int) {
+	switch name {
+	case "name":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || v == "" || len(v) > 32 {
+			return nil, errInvalidValue
+		}
+		rule.Name = v
+		return v, 0
+	case "status":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || (v != ruleEnabled && v != ruleDisabled) {
+			return nil, errInvalidValue
+		}
+		rule.Status = v
+		return v, 0
+	case "recycle":
+		var v bool
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		rule.Recycle = v
+		return v, 0
+	case "conditions":
+		var v []RuleCondition
+		if json.Unmarshal(raw, &v) != nil || len(v) == 0 || len(v) > 8 {
+			return nil, errRuleConditionError
+		}
+		for _, c := range v {
+			if !b.checkCondition(c) {
+				return nil, errRuleConditionError
+			}
+		}
+		rule.Conditions = v
+		return v, 0
+	case "actions":
+		var v []Command
+		if json.Unmarshal(raw, &v) != nil || len(v) == 0 || len(v) > 8 {
+			return nil, errRuleActionError
+		}
+		for i := range v {
+			if !checkRuleAction(v[i]) {
+				return nil, errRuleActionError
+			}
+			if v[i].Body == nil {
+				v[i].Body = map[string]interface{}{}
+			}
+		}
+		rule.Actions = v
+		return v, 0
+	}
+	return nil, errParameterNotAvailable
+}
+
+// ruleError builds the error entry of an invalid rule attribute
+func ruleError(errType int, address, name string, raw json.RawMessage) map[string]interface{} {
+	switch errType {
+	case errInvalidValue:
+		return newAPIError(errInvalidValue, address, rawValue(raw), name)
+	case errParameterNotAvailable, errParameterNotModifiable:
+		return newAPIError(errType, address, name)
+	}
+	return newAPIError(errType, address)
+}
+
+// handleCreateRule handles POST /rules. Conditions and actions are required
+// and their addresses must exist.
+func handleCreateRule(w http.ResponseWriter, r *http.Request, owner string, bridge *HueBridge) {
+	body, ok := decodeBody(w, r, "/rules")
+	if !ok {
+		return
+	}
+	_, hasConditions := body["conditions"]
+	_, hasActions := body["actions"]
+	if !hasConditions || !hasActions {
+		writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/rules")})
+		return
+	}
+
+	rule := &Rule{
+		Name:          "rule",
+		Owner:         owner,
+		Created:       bridge.Now().UTC().Format(timeLayout),
+		LastTriggered: "none",
+		Status:        ruleEnabled,
+	}
+	var errors []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		if _, errType := bridge.parseRuleAttribute(rule, attr, raw); errType != 0 {
+			errors = append(errors, ruleError(errType, "/rules/"+attr, attr, raw))
+		}
+	}
+	if len(errors) > 0 {
+		writeJSON(w, errors)
+		return
+	}
+
+	bridge.mu.Lock()
+	conditions, actions := bridge.ruleItemsLocked()
+	if len(bridge.rules) >= bridge.limits.Rules ||
+		conditions+len(rule.Conditions) > bridge.limits.Conditions ||
+		actions+len(rule.Actions) > bridge.limits.Actions {
+		bridge.mu.Unlock()
+		writeJSON(w, []interface{}{newAPIError(errRuleEngineFull, "/rules")})
+		return
+	}
+	id := bridge.nextRuleIDLocked()
+	bridge.rules[id] = rule
+	bridge.mu.Unlock()
+	bridge.startScheduler()
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"id": id}}})
+
+	log.Printf("Rule %s created: %q", id, rule.Name)
+}
+
+// handleUpdateRule handles PUT /rules/<id>
+func handleUpdateRule(w http.ResponseWriter, r *http.Request, ruleID string, bridge *HueBridge) {
+	address := "/rules/" + ruleID
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	bridge.mu.RLock()
+	rule, exists := bridge.rules[ruleID]
+	var updated Rule
+	if exists {
+		updated = *rule
+	}
+	bridge.mu.RUnlock()
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+
+	// Conditions are checked without b.mu, as resolving their addresses
+	// reads the datastore
+	var responses []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		attrAddress := address + "/" + attr
+		switch attr {
+		case "owner", "created", "lasttriggered", "timestriggered":
+			responses = append(responses, newAPIError(errParameterNotModifiable, attrAddress, attr))
+			continue
+		}
+		value, errType := bridge.parseRuleAttribute(&updated, attr, raw)
+		if errType != 0 {
+			responses = append(responses, ruleError(errType, attrAddress, attr, raw))
+			continue
+		}
+		responses = append(responses, newSuccess(attrAddress, value))
+	}
+
+	bridge.mu.Lock()
+	if rule, exists := bridge.rules[ruleID]; exists {
+		rule.Name, rule.Status, rule.Recycle = updated.Name, updated.Status, updated.Recycle
+		rule.Conditions, rule.Actions = updated.Conditions, updated.Actions
+	}
+	bridge.mu.Unlock()
+
+	writeJSON(w, responses)
+}
+
+func handleDeleteRule(w http.ResponseWriter, _ *http.Request, ruleID string, bridge *HueBridge) {
+	address := "/rules/" + ruleID
+
+	bridge.mu.Lock()
+	exists := bridge.deleteResourceLocked(address)
+	bridge.mu.Unlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+	writeJSON(w, []interface{}{map[string]interface{}{"success": address + " deleted"}})
+
+	log.Printf("Rule %s deleted", ruleID)
+}
@@ -0,0 +1,120 @@
+package hue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleConditionEvaluate(t *testing.T) {
+	// Saturday 31 January 2026, 23:30 UTC
+	now := time.Date(2026, 1, 31, 23, 30, 0, 0, time.UTC)
+	value := func(v interface{}) *addressState {
+		return &addressState{value: v, changed: now.Add(-time.Hour), observed: true}
+	}
+	changed := func(ago time.Duration, observed, dx bool) *addressState {
+		return &addressState{value: 1.0, changed: now.Add(-ago), observed: observed, dx: dx}
+	}
+	tests := []struct {
+		name     string
+		operator string
+		value    string
+		state    *addressState
+		want     bool
+	}{
+		{"unknown address", "eq", "true", nil, false},
+		{"eq bool", "eq", "true", value(true), true},
+		{"eq bool differs", "eq", "false", value(true), false},
+		{"eq number", "eq", "34", value(34.0), true},
+		{"eq number as decimal", "eq", "34.0", value(34.0), true},
+		{"eq number differs", "eq", "35", value(34.0), false},
+		{"eq string", "eq", "none", value("none"), true},
+		{"gt", "gt", "10", value(20.0), true},
+		{"gt equal", "gt", "20", value(20.0), false},
+		{"lt", "lt", "10", value(5.0), true},
+		{"lt on a string", "lt", "10", value("5"), false},
+		{"dx changed", "dx", "", changed(0, true, true), true},
+		{"dx unchanged", "dx", "", changed(0, true, false), false},
+		{"ddx elapsed", "ddx", "PT00:00:10", changed(10*time.Second, true, false), true},
+		{"ddx pending", "ddx", "PT00:00:10", changed(5*time.Second, true, true), false},
+		{"ddx never changed", "ddx", "PT00:00:10", changed(time.Hour, false, false), false},
+		{"stable", "stable", "PT00:01:00", changed(time.Minute, false, false), true},
+		{"stable too recent", "stable", "PT00:01:00", changed(30*time.Second, true, false), false},
+		{"not stable", "not stable", "PT00:01:00", changed(30*time.Second, true, false), true},
+		{"in", "in", "T22:00:00/T23:59:59", value(""), true},
+		{"in across midnight", "in", "T23:00:00/T07:00:00", value(""), true},
+		{"in outside", "in", "T07:00:00/T23:00:00", value(""), false},
+		{"in on the weekday", "in", "W2/T23:00:00/T07:00:00", value(""), true},
+		{"in on another weekday", "in", "W124/T23:00:00/T07:00:00", value(""), false},
+		{"not in", "not in", "T07:00:00/T23:00:00", value(""), true},
+		{"unknown operator", "ne", "true", value(true), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := RuleCondition{Address: "/sensors/1/state/x", Operator: tt.operator, Value: tt.value}
+			if got := c.evaluate(tt.state, now, time.UTC); got != tt.want {
+				t.Errorf("%s %q = %v, want %v", tt.operator, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInTimeIntervalAcrossMidnight(t *testing.T) {
+	// The early hours of Sunday belong to the interval started on Saturday
+	sunday := time.Date(2026, 2, 1, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		interval string
+		want     bool
+	}{
+		{"W2/T23:00:00/T07:00:00", true},
+		{"W1/T23:00:00/T07:00:00", false},
+		{"W1/T01:00:00/T07:00:00", true},
+	}
+	for _, tt := range tests {
+		if got := inTimeInterval(tt.interval, sunday); got != tt.want {
+			t.Errorf("inTimeInterval(%q) = %v, want %v", tt.interval, got, tt.want)
+		}
+	}
+}
+
+func TestRuleTriggers(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		value    string
+		// wait is how long the clock runs after light 2 is turned on
+		wait time.Duration
+		want bool
+	}{
+		{"eq", "eq", "true", 0, true},
+		{"dx", "dx", "", 0, true},
+		{"ddx pending", "ddx", "PT00:00:10", 5 * time.Second, false},
+		{"ddx elapsed", "ddx", "PT00:00:10", 10 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#rules")
+			b.CreateLight(1)
+			b.CreateLight(2)
+			b.SetClock(time.Date(2026, 1, 31, 8, 0, 0, 0, time.UTC))
+			h := b.Handler()
+			condition, _ := json.Marshal(RuleCondition{Address: "/lights/2/state/on", Operator: tt.operator, Value: tt.value})
+			body := `{"name":"Follow","conditions":[` + string(condition) + `],` +
+				`"actions":[{"address":"/lights/1/state","method":"PUT","body":{"on":true}}]}`
+			rec := serve(h, "POST", "/api/owner/rules", body, "")
+			if !strings.Contains(rec.Body.String(), "success") {
+				t.Fatalf("creating the rule: %s", rec.Body)
+			}
+
+			serve(h, "PUT", "/api/owner/lights/2/state", `{"on":true}`, "")
+			b.AdvanceClock(tt.wait)
+			light, _ := b.Light("1")
+			if got := light.Snapshot().On; got != tt.want {
+				t.Errorf("light on = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
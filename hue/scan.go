@@ -0,0 +1,140 @@
+package hue
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// scanDuration is how long a search for new lights lasts
+const scanDuration = 40 * time.Second
+
+// QueueLight adds an undiscovered light, which the bridge finds and creates
+// during the next search for new lights. It returns the number of lights
+// waiting to be discovered, or an error if the light list of the bridge has
+// no room left for the light.
+func (b *HueBridge) QueueLight() (int, error) {
+	b.mu.Lock()
+	if len(b.lights)+b.undiscoveredLights >= b.limits.Lights {
+		b.mu.Unlock()
+		return 0, fmt.Errorf("light list is full (%d lights)", b.limits.Lights)
+	}
+	b.undiscoveredLights++
+	b.mu.Unlock()
+
+	// A search in progress finds the light right away
+	b.discoverLights()
+	return b.UndiscoveredLights(), nil
+}
+
+// UndiscoveredLights returns the number of lights waiting for a search
+func (b *HueBridge) UndiscoveredLights() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.undiscoveredLights
+}
+
+// StartScan starts a 40 second search for new lights, finding the lights
+// queued with QueueLight.
+func (b *HueBridge) StartScan() {
+	b.mu.Lock()
+	if !b.scanActiveLocked() {
+		b.newLights = make(map[string]bool)
+	}
+	b.scanStarted = time.Now()
+	b.mu.Unlock()
+
+	b.discoverLights()
+}
+
+// scanActiveLocked reports whether a search is in progress, with b.mu held
+func (b *HueBridge) scanActiveLocked() bool {
+	return !b.scanStarted.IsZero() && time.Since(b.scanStarted) < scanDuration
+}
+
+// discoverLights creates the queued lights if a search is in progress. Lights
+// beyond the light limit, which may have been lowered since they were queued,
+// stay queued.
+func (b *HueBridge) discoverLights() {
+	b.mu.Lock()
+	found := b.undiscoveredLights
+	if free := b.limits.Lights - len(b.lights); found > free {
+		found = free
+	}
+	if !b.scanActiveLocked() || found <= 0 {
+		b.mu.Unlock()
+		return
+	}
+	ids := make([]int, found)
+	next := b.nextLightIDLocked()
+	for i := range ids {
+		ids[i] = next + i
+		// Reserve the ID until the light is created
+		b.newLights[strconv.Itoa(ids[i])] = true
+	}
+	b.undiscoveredLights -= found
+	b.mu.Unlock()
+
+	for _, id := range ids {
+		if _, err := b.CreateLight(id); err != nil {
+			log.Printf("Light %d not discovered: %v", id, err)
+			continue
+		}
+		log.Printf("Light %d discovered", id)
+	}
+}
+
+// nextLightIDLocked returns the lowest v1 light ID above all existing and
+// newly found lights, with b.mu held
+func (b *HueBridge) nextLightIDLocked() int {
+	next := 1
+	reserve := func(id string) {
+		if n, err := strconv.Atoi(id); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	for id := range b.lights {
+		reserve(id)
+	}
+	for id := range b.newLights {
+		reserve(id)
+	}
+	return next
+}
+
+// newLightsResult returns the lights found by the last search along with
+// its status: "none", "active" or the time the search ended.
+func (b *HueBridge) newLightsResult() map[string]interface{} {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	result := make(map[string]interface{}, len(b.newLights)+1)
+	switch {
+	case b.scanStarted.IsZero():
+		result["lastscan"] = "none"
+	case b.scanActiveLocked():
+		result["lastscan"] = "active"
+	default:
+		result["lastscan"] = b.scanStarted.Add(scanDuration).UTC().Format(timeLayout)
+	}
+	for id := range b.newLights {
+		// Lights deleted since the search are not reported
+		if light, exists := b.lights[id]; exists {
+			result[id] = map[string]string{"name": light.DisplayName()}
+		}
+	}
+	return result
+}
+
+// handleSearchLights handles POST /lights, which starts a search for new
+// lights. The optional list of device IDs to search for is ignored.
+func handleSearchLights(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	bridge.StartScan()
+	writeJSON(w, []interface{}{newSuccess("/lights", "Searching for new devices")})
+}
+
+func handleGetNewLights(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.newLightsResult())
+}
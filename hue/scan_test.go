@@ -0,0 +1,57 @@
+package hue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSearchLights(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#search")
+	b.CreateLight(1)
+	h := b.Handler()
+	newLights := func() map[string]interface{} {
+		t.Helper()
+		var result map[string]interface{}
+		rec := serve(h, "GET", "/api/owner/lights/new", "", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("GET /lights/new = %s", rec.Body)
+		}
+		return result
+	}
+
+	for want := 1; want <= 2; want++ {
+		if n, err := b.QueueLight(); n != want || err != nil {
+			t.Errorf("QueueLight() = %d, %v, want %d", n, err, want)
+		}
+	}
+	if ids := b.LightIDs(); len(ids) != 1 {
+		t.Errorf("lights %v created before a search", ids)
+	}
+	if result := newLights(); len(result) != 1 || result["lastscan"] != "none" {
+		t.Errorf("new lights before a search = %v", result)
+	}
+
+	rec := serve(h, "POST", "/api/owner/lights", "", "")
+	if !strings.Contains(rec.Body.String(), `[{"success":{"/lights":"Searching for new devices"}}]`) {
+		t.Errorf("POST /lights = %s", rec.Body)
+	}
+	// A search in progress finds lights as soon as they are queued
+	if n, err := b.QueueLight(); n != 0 || err != nil {
+		t.Errorf("QueueLight() during the search = %d, %v, want 0", n, err)
+	}
+	result := newLights()
+	if result["lastscan"] != "active" || len(result) != 4 {
+		t.Errorf("new lights = %v, want lights 2, 3 and 4 during an active search", result)
+	}
+	for _, id := range []string{"2", "3", "4"} {
+		if _, found := result[id]; !found {
+			t.Errorf("light %s not reported as new", id)
+		}
+	}
+	if b.UndiscoveredLights() != 0 {
+		t.Errorf("%d lights still undiscovered", b.UndiscoveredLights())
+	}
+}
@@ -0,0 +1,515 @@
+package hue
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Scene types supported by the v1 API
+const (
+	sceneTypeLight = "LightScene"
+	sceneTypeGroup = "GroupScene"
+)
+
+// Scene is a v1 scene: a stored state per light, recalled through the
+// action of a group
+type Scene struct {
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`            // LightScene or GroupScene
+	Group       string       `json:"group,omitempty"` // group scenes only
+	Lights      []string     `json:"lights"`
+	Owner       string       `json:"owner"`
+	Recycle     bool         `json:"recycle"`
+	Locked      bool         `json:"locked"` // set while a schedule or rule uses the scene
+	AppData     SceneAppData `json:"appdata"`
+	Picture     string       `json:"picture"`
+	LastUpdated string       `json:"lastupdated"`
+	Version     int          `json:"version"`
+	// LightStates holds the state recalled for every light of the scene.
+	// It is only reported when getting a single scene.
+	LightStates map[string]StateUpdate `json:"lightstates,omitempty"`
+
+	// v2ID is the ID of the CLIP v2 scene
+	v2ID string
+	// palette, speed and autoDynamic set how a dynamic recall cycles the
+	// lights through colors, see v2scenes.go
+	palette     V2Palette
+	speed       float64
+	autoDynamic bool
+	// status is how the scene was last recalled, until another scene of
+	// its group is
+	status string
+	// stopDynamic stops the palette cycling of a dynamic recall
+	stopDynamic chan struct{}
+}
+
+// SceneAppData is free data stored along a scene by the application
+type SceneAppData struct {
+	Version int    `json:"version,omitempty"`
+	Data    string `json:"data,omitempty"`
+}
+
+// newScene returns an empty scene of the given type, inactive and with the
+// default speed
+func newScene(sceneType, owner string) *Scene {
+	return &Scene{
+		Type:    sceneType,
+		Owner:   owner,
+		Version: 2,
+		v2ID:    uuid.New().String(),
+		speed:   defaultSceneSpeed,
+		status:  sceneInactive,
+	}
+}
+
+// sceneStateOf returns the scene light state storing s: the on state, the
+// brightness and the color in the current color mode
+func sceneStateOf(s LightState) StateUpdate {
+	update := StateUpdate{On: &s.On, Brightness: &s.Brightness}
+	switch s.ColorMode {
+	case "hs":
+		update.Hue, update.Saturation = &s.Hue, &s.Saturation
+	case "ct":
+		update.ColorTemp = &s.ColorTemp
+	default:
+		update.XY = &s.XY
+	}
+	return update
+}
+
+// storeLightStatesLocked captures the current state of the scene lights;
+// b.mu must be held
+func (b *HueBridge) storeLightStatesLocked(scene *Scene) {
+	scene.LightStates = make(map[string]StateUpdate, len(scene.Lights))
+	for _, id := range scene.Lights {
+		if light, exists := b.lights[id]; exists {
+			scene.LightStates[id] = sceneStateOf(light.Snapshot())
+		}
+	}
+}
+
+// v1Scenes returns all scenes keyed by their ID, without their light states
+func (b *HueBridge) v1Scenes() map[string]Scene {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	scenes := make(map[string]Scene, len(b.scenes))
+	for id, scene := range b.scenes {
+		s := *scene
+		s.LightStates = nil
+		s.Locked = b.sceneInUseLocked(id)
+		scenes[id] = s
+	}
+	return scenes
+}
+
+// sceneInUseLocked reports whether a schedule or a rule recalls the scene,
+// in which case it cannot be deleted; b.mu must be held
+func (b *HueBridge) sceneInUseLocked(id string) bool {
+	for _, s := range b.schedules {
+		if s.Command.Body["scene"] == id {
+			return true
+		}
+	}
+	for _, rule := range b.rules {
+		for _, action := range rule.Actions {
+			if action.Body["scene"] == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newSceneID returns a random scene ID in the format of the bridge
+func newSceneID() string {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	buf := make([]byte, 15)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	for i, c := range buf {
+		buf[i] = chars[int(c)%len(chars)]
+	}
+	return string(buf)
+}
+
+// checkSceneLightsLocked decodes the lights of a scene, which must exist.
+// It returns the v1 error entry reported at address otherwise. b.mu must be
+// held.
+func (b *HueBridge) checkSceneLightsLocked(raw json.RawMessage, address string) ([]string, map[string]interface{}) {
+	var ids []string
+	if json.Unmarshal(raw, &ids) != nil || len(ids) == 0 {
+		return nil, newAPIError(errInvalidValue, address, rawValue(raw), "lights")
+	}
+	for _, id := range ids {
+		if _, exists := b.lights[id]; !exists {
+			return nil, newAPIError(errInvalidValue, address, id, "lights")
+		}
+	}
+	return ids, nil
+}
+
+// recallScene applies the states of the scene to its lights that belong to
+// the group groupID, overriding the transition time of the scene when
+// transitionTime is set. It returns false if there is no such scene.
+func (b *HueBridge) recallScene(sceneID, groupID string, transitionTime *uint16) bool {
+	b.mu.Lock()
+	scene, exists := b.scenes[sceneID]
+	if !exists {
+		b.mu.Unlock()
+		return false
+	}
+	b.activateSceneLocked(sceneID, sceneStatic)
+	group, _ := b.groupLocked(groupID)
+	inGroup := make(map[string]bool)
+	if group != nil {
+		for _, id := range group.Lights {
+			inGroup[id] = true
+		}
+	}
+	lights := make(map[*HueLight]StateUpdate, len(scene.LightStates))
+	for id, state := range scene.LightStates {
+		if light, exists := b.lights[id]; exists && inGroup[id] {
+			lights[light] = state
+		}
+	}
+	b.mu.Unlock()
+
+	for light, state := range lights {
+		if transitionTime != nil {
+			state.TransitionTime = transitionTime
+		}
+		light.updateLightState(state)
+	}
+	return true
+}
+
+func handleGetScenes(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.v1Scenes())
+}
+
+func handleGetScene(w http.ResponseWriter, _ *http.Request, sceneID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	scene, exists := bridge.scenes[sceneID]
+	var s Scene
+	if exists {
+		s = *scene
+		s.Locked = bridge.sceneInUseLocked(sceneID)
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/scenes/"+sceneID, "/scenes/"+sceneID)})
+		return
+	}
+	writeJSON(w, s)
+}
+
+// parseSceneAttribute decodes the scene attributes common to creation and
+// update into scene. It returns the value to report, or the v1 error type if
+// the attribute is invalid.
+func parseSceneAttribute(scene *Scene, name string, raw json.RawMessage) (interface{}, int) {
+	switch name {
+	case "name":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || v == "" || len(v) > 32 {
+			return nil, errInvalidValue
+		}
+		scene.Name = v
+		return v, 0
+	case "appdata":
+		var v SceneAppData
+		if json.Unmarshal(raw, &v) != nil || len(v.Data) > 16 {
+			return nil, errInvalidValue
+		}
+		scene.AppData = v
+		return v, 0
+	case "picture":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || len(v) > 16 {
+			return nil, errInvalidValue
+		}
+		scene.Picture = v
+		return v, 0
+	}
+	return nil, errParameterNotAvailable
+}
+
+// handleCreateScene handles POST /scenes. The states of the scene lights are
+// captured from their current state unless given in lightstates.
+func handleCreateScene(w http.ResponseWriter, r *http.Request, owner string, bridge *HueBridge) {
+	body, ok := decodeBody(w, r, "/scenes")
+	if !ok {
+		return
+	}
+
+	scene := newScene(sceneTypeLight, owner)
+	if raw, exists := body["type"]; exists {
+		if json.Unmarshal(raw, &scene.Type) != nil || (scene.Type != sceneTypeLight && scene.Type != sceneTypeGroup) {
+			writeJSON(w, []interface{}{newAPIError(errInvalidValue, "/scenes/type", rawValue(raw), "type")})
+			return
+		}
+	}
+	if _, exists := body["name"]; !exists {
+		writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/scenes")})
+		return
+	}
+
+	var errors []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		address := "/scenes/" + attr
+		switch attr {
+		case "type", "lights", "group", "lightstates":
+			// Decoded below, as they depend on the lights of the bridge
+		case "recycle":
+			if json.Unmarshal(raw, &scene.Recycle) != nil {
+				errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+			}
+		default:
+			if _, errType := parseSceneAttribute(scene, attr, raw); errType == errInvalidValue {
+				errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+			} else if errType != 0 {
+				errors = append(errors, newAPIError(errType, address, attr))
+			}
+		}
+	}
+	if len(errors) > 0 {
+		writeJSON(w, errors)
+		return
+	}
+
+	var lightStates map[string]json.RawMessage
+	if raw, exists := body["lightstates"]; exists && json.Unmarshal(raw, &lightStates) != nil {
+		writeJSON(w, []interface{}{newAPIError(errInvalidValue, "/scenes/lightstates", rawValue(raw), "lightstates")})
+		return
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	if len(bridge.scenes) >= bridge.limits.Scenes {
+		writeJSON(w, []interface{}{newAPIError(errSceneBufferFull, "/scenes")})
+		return
+	}
+
+	if scene.Type == sceneTypeGroup {
+		var groupID string
+		raw, exists := body["group"]
+		if !exists {
+			writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/scenes")})
+			return
+		}
+		var group *Group
+		if json.Unmarshal(raw, &groupID) == nil {
+			group = bridge.groups[groupID]
+		}
+		if group == nil {
+			writeJSON(w, []interface{}{newAPIError(errInvalidValue, "/scenes/group", rawValue(raw), "group")})
+			return
+		}
+		if _, exists := body["lights"]; exists {
+			writeJSON(w, []interface{}{newAPIError(errParameterNotModifiable, "/scenes/lights", "lights")})
+			return
+		}
+		scene.Group = groupID
+		scene.Lights = append([]string{}, group.Lights...)
+	} else {
+		raw, exists := body["lights"]
+		if !exists {
+			writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/scenes")})
+			return
+		}
+		lights, apiErr := bridge.checkSceneLightsLocked(raw, "/scenes/lights")
+		if apiErr != nil {
+			writeJSON(w, []interface{}{apiErr})
+			return
+		}
+		scene.Lights = lights
+	}
+
+	if bridge.lightStatesLocked()+len(scene.Lights) > bridge.limits.LightStates {
+		writeJSON(w, []interface{}{newAPIError(errSceneBufferFull, "/scenes")})
+		return
+	}
+	bridge.storeLightStatesLocked(scene)
+	for _, lightID := range sortedKeys(lightStates) {
+		address := "/scenes/lightstates/" + lightID
+		light, exists := bridge.lights[lightID]
+		if _, stored := scene.LightStates[lightID]; !exists || !stored {
+			writeJSON(w, []interface{}{newAPIError(errInvalidValue, address, lightID, "lightstates")})
+			return
+		}
+		var body map[string]json.RawMessage
+		if json.Unmarshal(lightStates[lightID], &body) != nil {
+			writeJSON(w, []interface{}{newAPIError(errInvalidValue, address, rawValue(lightStates[lightID]), "lightstates")})
+			return
+		}
+		update, responses := parseStateUpdate(body, address, true, light.Capabilities)
+		if apiErr := firstAPIError(responses); apiErr != nil {
+			writeJSON(w, []interface{}{apiErr})
+			return
+		}
+		scene.LightStates[lightID] = update
+	}
+
+	id := newSceneID()
+	scene.LastUpdated = bridge.Now().UTC().Format(timeLayout)
+	bridge.scenes[id] = scene
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"id": id}}})
+
+	log.Printf("Scene %s created: %s %q with lights %v", id, scene.Type, scene.Name, scene.Lights)
+}
+
+// firstAPIError returns the first error entry of responses, or nil
+func firstAPIError(responses []interface{}) interface{} {
+	for _, response := range responses {
+		if entry, ok := response.(map[string]interface{}); ok && entry["error"] != nil {
+			return entry
+		}
+	}
+	return nil
+}
+
+// handleUpdateScene handles PUT /scenes/<id>. storelightstate captures the
+// current state of the scene lights again.
+func handleUpdateScene(w http.ResponseWriter, r *http.Request, sceneID string, bridge *HueBridge) {
+	address := "/scenes/" + sceneID
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	scene, exists := bridge.scenes[sceneID]
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+
+	var responses []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		attrAddress := address + "/" + attr
+		switch attr {
+		case "lights":
+			if scene.Type == sceneTypeGroup {
+				responses = append(responses, newAPIError(errParameterNotModifiable, attrAddress, attr))
+				continue
+			}
+			lights, apiErr := bridge.checkSceneLightsLocked(raw, attrAddress)
+			if apiErr != nil {
+				responses = append(responses, apiErr)
+				continue
+			}
+			if bridge.lightStatesLocked()-len(scene.Lights)+len(lights) > bridge.limits.LightStates {
+				responses = append(responses, newAPIError(errSceneBufferFull, attrAddress))
+				continue
+			}
+			scene.Lights = lights
+			// Keep the stored states of remaining lights and capture the others
+			states := scene.LightStates
+			bridge.storeLightStatesLocked(scene)
+			for id, state := range states {
+				if _, kept := scene.LightStates[id]; kept {
+					scene.LightStates[id] = state
+				}
+			}
+			responses = append(responses, newSuccess(attrAddress, lights))
+		case "storelightstate":
+			var store bool
+			if json.Unmarshal(raw, &store) != nil {
+				responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), attr))
+				continue
+			}
+			if store {
+				bridge.storeLightStatesLocked(scene)
+			}
+			responses = append(responses, newSuccess(attrAddress, store))
+		case "type", "group", "owner", "recycle", "locked", "version", "lastupdated":
+			responses = append(responses, newAPIError(errParameterNotModifiable, attrAddress, attr))
+		default:
+			value, errType := parseSceneAttribute(scene, attr, raw)
+			switch errType {
+			case 0:
+				responses = append(responses, newSuccess(attrAddress, value))
+			case errInvalidValue:
+				responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), attr))
+			default:
+				responses = append(responses, newAPIError(errType, attrAddress, attr))
+			}
+		}
+	}
+	scene.LastUpdated = bridge.Now().UTC().Format(timeLayout)
+
+	writeJSON(w, responses)
+}
+
+// handleUpdateSceneLightState handles PUT /scenes/<id>/lightstates/<light>,
+// which changes the stored state of a single light of the scene
+func handleUpdateSceneLightState(w http.ResponseWriter, r *http.Request, sceneID, lightID string, bridge *HueBridge) {
+	address := "/scenes/" + sceneID + "/lightstates/" + lightID
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	scene, exists := bridge.scenes[sceneID]
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/scenes/"+sceneID, "/scenes/"+sceneID)})
+		return
+	}
+	light, exists := bridge.lights[lightID]
+	state, stored := scene.LightStates[lightID]
+	if !exists || !stored {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+
+	update, responses := parseStateUpdate(body, address, true, light.Capabilities)
+	scene.LightStates[lightID] = mergeStateUpdate(state, update)
+	scene.LastUpdated = bridge.Now().UTC().Format(timeLayout)
+
+	writeJSON(w, responses)
+}
+
+// mergeStateUpdate returns base with the attributes set in update replacing
+// its own. A new color replaces the stored color whatever its mode.
+func mergeStateUpdate(base, update StateUpdate) StateUpdate {
+	if update.Hue != nil || update.Saturation != nil || update.ColorTemp != nil || update.XY != nil {
+		base.Hue, base.Saturation, base.ColorTemp, base.XY = nil, nil, nil, nil
+	}
+	// Only the attributes set in update are encoded
+	merged, _ := json.Marshal(update)
+	json.Unmarshal(merged, &base)
+	return base
+}
+
+func handleDeleteScene(w http.ResponseWriter, _ *http.Request, sceneID string, bridge *HueBridge) {
+	address := "/scenes/" + sceneID
+
+	bridge.mu.Lock()
+	_, exists := bridge.scenes[sceneID]
+	locked := exists && bridge.sceneInUseLocked(sceneID)
+	if exists && !locked {
+		bridge.deleteResourceLocked(address)
+	}
+	bridge.mu.Unlock()
+
+	switch {
+	case !exists:
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+	case locked:
+		writeJSON(w, []interface{}{newAPIError(errSceneInUse, address)})
+	default:
+		writeJSON(w, []interface{}{map[string]interface{}{"success": address + " deleted"}})
+		log.Printf("Scene %s deleted", sceneID)
+	}
+}
@@ -0,0 +1,107 @@
+package hue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// createScene creates a scene through the v1 API and returns its ID
+func createScene(t *testing.T, b *HueBridge, body string) string {
+	t.Helper()
+	rec := serve(b.Handler(), "POST", "/api/owner/scenes", body, "")
+	var created []struct {
+		Success struct {
+			ID string `json:"id"`
+		} `json:"success"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || len(created) != 1 || created[0].Success.ID == "" {
+		t.Fatalf("POST /scenes %s = %s", body, rec.Body)
+	}
+	return created[0].Success.ID
+}
+
+func TestCreateScene(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"light scene", `{"name":"Evening","lights":["1"]}`, `"success":{"id":`},
+		{"group scene", `{"name":"Evening","type":"GroupScene","group":"1"}`, `"success":{"id":`},
+		{"light states", `{"name":"Evening","lights":["1"],"lightstates":{"1":{"on":true,"bri":50}}}`, `"success":{"id":`},
+		{"without a name", `{"lights":["1"]}`, `"type":5`},
+		{"without lights", `{"name":"Evening"}`, `"type":5`},
+		{"unknown light", `{"name":"Evening","lights":["9"]}`, `"type":7`},
+		{"unknown group", `{"name":"Evening","type":"GroupScene","group":"9"}`, `"type":7`},
+		{"lights of a group scene", `{"name":"Evening","type":"GroupScene","group":"1","lights":["1"]}`, `"type":8`},
+		{"state of another light", `{"name":"Evening","lights":["1"],"lightstates":{"2":{"on":true}}}`, `"type":7`},
+		{"unknown attribute", `{"name":"Evening","lights":["1"],"color":"red"}`, `"type":6`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#scenes")
+			b.CreateLight(1)
+			b.CreateLight(2)
+			h := b.Handler()
+			serve(h, "POST", "/api/owner/groups", `{"name":"Room","type":"Room","lights":["1"]}`, "")
+
+			rec := serve(h, "POST", "/api/owner/scenes", tt.body, "")
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("POST /scenes %s = %s, want %s", tt.body, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecallScene(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#scenes")
+	b.CreateLight(1)
+	b.CreateLight(2)
+	h := b.Handler()
+	serve(h, "POST", "/api/owner/groups", `{"name":"Room","type":"Room","lights":["1"]}`, "")
+	serve(h, "PUT", "/api/owner/lights/1/state", `{"on":true,"bri":200,"transitiontime":0}`, "")
+	light1, _ := b.Light("1")
+	light2, _ := b.Light("2")
+
+	// The scene captures the current state of its lights
+	id := createScene(t, b, `{"name":"Evening","lights":["1","2"],"lightstates":{"2":{"on":true,"bri":50}}}`)
+	serve(h, "PUT", "/api/owner/groups/0/action", `{"on":false}`, "")
+
+	rec := serve(h, "PUT", "/api/owner/groups/1/action", `{"scene":"`+id+`"}`, "")
+	if !strings.Contains(rec.Body.String(), `[{"success":{"/groups/1/action/scene":"`+id+`"}}]`) {
+		t.Errorf("recall = %s", rec.Body)
+	}
+	// Only the lights of the group are recalled
+	if s := light1.Snapshot(); !s.On || s.Brightness != 200 {
+		t.Errorf("light 1 = on %v, bri %d after the recall", s.On, s.Brightness)
+	}
+	if light2.Snapshot().On {
+		t.Error("light 2 outside the group was recalled")
+	}
+
+	serve(h, "PUT", "/api/owner/groups/0/action", `{"scene":"`+id+`"}`, "")
+	if s := light2.Snapshot(); !s.On || s.Brightness != 50 {
+		t.Errorf("light 2 = on %v, bri %d after the recall", s.On, s.Brightness)
+	}
+
+	// Stored states can be changed afterwards
+	serve(h, "PUT", "/api/owner/scenes/"+id+"/lightstates/1", `{"bri":120}`, "")
+	serve(h, "PUT", "/api/owner/groups/0/action", `{"scene":"`+id+`"}`, "")
+	if bri := light1.Snapshot().Brightness; bri != 120 {
+		t.Errorf("light 1 bri = %d after changing its stored state", bri)
+	}
+
+	rec = serve(h, "PUT", "/api/owner/groups/0/action", `{"scene":"unknown"}`, "")
+	if !strings.Contains(rec.Body.String(), `"type":3`) {
+		t.Errorf("recall of an unknown scene = %s", rec.Body)
+	}
+	rec = serve(h, "DELETE", "/api/owner/scenes/"+id, "", "")
+	if !strings.Contains(rec.Body.String(), `"success":"/scenes/`+id+` deleted"`) {
+		t.Errorf("DELETE = %s", rec.Body)
+	}
+}
@@ -0,0 +1,484 @@
+package hue
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule statuses
+const (
+	scheduleEnabled  = "enabled"
+	scheduleDisabled = "disabled"
+)
+
+// Command is a v1 API request the bridge runs on itself, e.g. when a
+// schedule triggers
+type Command struct {
+	Address string                 `json:"address"` // e.g. /api/<user>/groups/0/action
+	Method  string                 `json:"method"`  // PUT, POST or DELETE
+	Body    map[string]interface{} `json:"body"`
+}
+
+// Schedule is a v1 schedule, running a command at the times of a pattern
+type Schedule struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Command     Command `json:"command"`
+	// LocalTime is the time pattern in the timezone of the bridge
+	LocalTime string `json:"localtime"`
+	// Time is the deprecated UTC equivalent of LocalTime
+	Time       string `json:"time"`
+	Created    string `json:"created"`
+	Status     string `json:"status"`
+	AutoDelete bool   `json:"autodelete"`
+	StartTime  string `json:"starttime,omitempty"` // timers only
+	Recycle    bool   `json:"recycle"`
+
+	pattern timePattern
+	// start is when the timer was started
+	start time.Time
+	// next is the next trigger time, zero when the schedule is disabled
+	next time.Time
+	// remaining is the number of runs left for repeated timers, -1 for forever
+	remaining int
+}
+
+// checkCommand reports whether cmd is a valid command of the v1 API
+func checkCommand(cmd Command) bool {
+	parts := strings.Split(strings.Trim(cmd.Address, "/"), "/")
+	if len(parts) < 3 || parts[0] != "api" {
+		return false
+	}
+	switch cmd.Method {
+	case "PUT", "POST", "DELETE":
+		return true
+	}
+	return false
+}
+
+// runCommand runs cmd against the v1 API of the bridge and returns the
+// response body
+func (b *HueBridge) runCommand(cmd Command) []byte {
+	body, _ := json.Marshal(cmd.Body)
+	req, err := http.NewRequest(cmd.Method, cmd.Address, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Invalid command %s %s: %v", cmd.Method, cmd.Address, err)
+		return nil
+	}
+	rec := httptest.NewRecorder()
+	handleHueAPI(rec, req, b)
+	log.Printf("Command %s %s %s: %s", cmd.Method, cmd.Address, body, bytes.TrimSpace(rec.Body.Bytes()))
+	return rec.Body.Bytes()
+}
+
+// startScheduleLocked (re)starts schedule s from now; b.mu must be held
+func (b *HueBridge) startScheduleLocked(s *Schedule, now time.Time, loc *time.Location) {
+	s.next = time.Time{}
+	if s.Status != scheduleEnabled {
+		return
+	}
+	if s.pattern.kind == patternTimer {
+		s.start = now
+		s.StartTime = now.UTC().Format(timeLayout)
+		s.remaining = s.pattern.repeat
+	}
+	s.next = s.pattern.next(now, s.start, loc)
+}
+
+// setScheduleTime sets the time pattern of s from either its local or its
+// UTC form. It returns the v1 error type if the pattern is not valid.
+func setScheduleTime(s *Schedule, pattern string, utc bool, loc *time.Location) int {
+	p, ok := parseTimePattern(pattern)
+	if !ok {
+		return errInvalidValue
+	}
+	s.pattern = p
+	s.LocalTime, s.Time = pattern, pattern
+	if p.kind == patternAbsolute {
+		// Absolute times are converted between UTC and local time
+		if utc {
+			local := p.date.In(loc)
+			s.pattern.date = time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, time.UTC)
+			s.LocalTime = s.pattern.date.Format(timeLayout)
+		} else {
+			t := time.Date(p.date.Year(), p.date.Month(), p.date.Day(), p.date.Hour(), p.date.Minute(), p.date.Second(), 0, loc)
+			s.Time = t.UTC().Format(timeLayout)
+		}
+	}
+	return 0
+}
+
+// rescheduleAll recomputes the next trigger of every recurring schedule,
+// after the clock was moved back. b.schedulerMu must be held.
+func (b *HueBridge) rescheduleAll() {
+	now, loc := b.Now(), b.location()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.schedules {
+		if s.Status == scheduleEnabled && s.pattern.kind != patternTimer {
+			s.next = s.pattern.next(now, s.start, loc)
+		}
+	}
+}
+
+// startScheduler starts running due schedules and evaluating rules in real
+// time, once, until the bridge is closed
+func (b *HueBridge) startScheduler() {
+	b.schedulerOnce.Do(func() {
+		ticker := time.NewTicker(time.Second)
+		go func() {
+			defer ticker.Stop()
+			for {
+				select {
+				case <-b.stop:
+					return
+				case <-ticker.C:
+					b.runSchedulesUntil(b.Now())
+				}
+			}
+		}()
+	})
+}
+
+// runSchedulesUntil runs every schedule due up to the given time in order,
+// moving the clock to the time of each as it runs
+func (b *HueBridge) runSchedulesUntil(until time.Time) {
+	b.schedulerMu.Lock()
+	defer b.schedulerMu.Unlock()
+
+	for {
+		id, at := b.nextDueSchedule(until)
+		if id == "" {
+			break
+		}
+		if at.After(b.Now()) {
+			b.clock.set(at)
+		}
+		b.triggerSchedule(id, at)
+		b.evaluateRules()
+	}
+	if until.After(b.Now()) {
+		b.clock.set(until)
+	}
+	// Time conditions of rules may hold now
+	b.evaluateRules()
+}
+
+// nextDueSchedule returns the schedule triggering first, if it is due by
+// the given time
+func (b *HueBridge) nextDueSchedule(until time.Time) (string, time.Time) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var firstID string
+	var first time.Time
+	for id, s := range b.schedules {
+		if s.next.IsZero() || s.next.After(until) {
+			continue
+		}
+		if firstID == "" || s.next.Before(first) {
+			firstID, first = id, s.next
+		}
+	}
+	return firstID, first
+}
+
+// triggerSchedule runs the command of schedule id due at the given time and
+// computes its next trigger. Schedules that are done are deleted or
+// disabled according to their autodelete attribute.
+func (b *HueBridge) triggerSchedule(id string, at time.Time) {
+	loc := b.location()
+	b.mu.Lock()
+	s, exists := b.schedules[id]
+	if !exists {
+		b.mu.Unlock()
+		return
+	}
+	cmd := s.Command
+	s.next = time.Time{}
+	switch s.pattern.kind {
+	case patternRecurring:
+		s.next = s.pattern.next(at, s.start, loc)
+	case patternTimer:
+		if s.remaining > 0 {
+			s.remaining--
+		}
+		if s.remaining != 0 {
+			s.start = at
+			s.next = s.pattern.next(at, s.start, loc)
+		}
+	}
+	if s.next.IsZero() {
+		if s.AutoDelete {
+			delete(b.schedules, id)
+		} else {
+			s.Status = scheduleDisabled
+		}
+	}
+	b.mu.Unlock()
+
+	log.Printf("Schedule %s triggered", id)
+	b.runCommand(cmd)
+}
+
+// v1Schedules returns all schedules keyed by their v1 ID
+func (b *HueBridge) v1Schedules() map[string]Schedule {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	schedules := make(map[string]Schedule, len(b.schedules))
+	for id, s := range b.schedules {
+		schedules[id] = *s
+	}
+	return schedules
+}
+
+// nextScheduleIDLocked returns the lowest free schedule ID; b.mu must be held
+func (b *HueBridge) nextScheduleIDLocked() string {
+	for n := 1; ; n++ {
+		if _, exists := b.schedules[strconv.Itoa(n)]; !exists {
+			return strconv.Itoa(n)
+		}
+	}
+}
+
+func handleGetSchedules(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.v1Schedules())
+}
+
+func handleGetSchedule(w http.ResponseWriter, _ *http.Request, scheduleID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	s, exists := bridge.schedules[scheduleID]
+	var v Schedule
+	if exists {
+		v = *s
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/schedules/"+scheduleID, "/schedules/"+scheduleID)})
+		return
+	}
+	writeJSON(w, v)
+}
+
+// parseScheduleAttribute decodes a schedule attribute into s, except for
+// the time pattern. It returns the value to report, or the v1 error type if
+// the attribute is invalid.
+func parseScheduleAttribute(s *Schedule, name string, raw json.RawMessage) (interface{}, int) {
+	switch name {
+	case "name", "description":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || (name == "name" && len(v) > 32) || len(v) > 64 {
+			return nil, errInvalidValue
+		}
+		if name == "name" {
+			s.Name = v
+		} else {
+			s.Description = v
+		}
+		return v, 0
+	case "command":
+		var v Command
+		if json.Unmarshal(raw, &v) != nil || !checkCommand(v) {
+			return nil, errScheduleCommandError
+		}
+		if v.Body == nil {
+			v.Body = map[string]interface{}{}
+		}
+		s.Command = v
+		return v, 0
+	case "status":
+		var v string
+		if json.Unmarshal(raw, &v) != nil || (v != scheduleEnabled && v != scheduleDisabled) {
+			return nil, errInvalidValue
+		}
+		s.Status = v
+		return v, 0
+	case "autodelete":
+		var v bool
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		s.AutoDelete = v
+		return v, 0
+	case "recycle":
+		var v bool
+		if json.Unmarshal(raw, &v) != nil {
+			return nil, errInvalidValue
+		}
+		s.Recycle = v
+		return v, 0
+	}
+	return nil, errParameterNotAvailable
+}
+
+// scheduleError builds the error entry of an invalid schedule attribute
+func scheduleError(errType int, address, name string, raw json.RawMessage) map[string]interface{} {
+	switch errType {
+	case errInvalidValue:
+		return newAPIError(errInvalidValue, address, rawValue(raw), name)
+	case errParameterNotAvailable, errParameterNotModifiable:
+		return newAPIError(errType, address, name)
+	}
+	return newAPIError(errType, address)
+}
+
+// handleCreateSchedule handles POST /schedules. A command and a time
+// pattern, local or UTC, are required.
+func handleCreateSchedule(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	body, ok := decodeBody(w, r, "/schedules")
+	if !ok {
+		return
+	}
+
+	_, hasLocalTime := body["localtime"]
+	_, hasTime := body["time"]
+	if _, hasCommand := body["command"]; !hasCommand || (!hasLocalTime && !hasTime) {
+		writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/schedules")})
+		return
+	}
+	if hasLocalTime && hasTime {
+		writeJSON(w, []interface{}{newAPIError(errScheduleTimeConflict, "/schedules")})
+		return
+	}
+
+	now, loc := bridge.Now(), bridge.location()
+	s := &Schedule{
+		Name:       "schedule",
+		Created:    now.UTC().Format(timeLayout),
+		Status:     scheduleEnabled,
+		AutoDelete: true,
+	}
+	var errors []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		address := "/schedules/" + attr
+		if attr == "localtime" || attr == "time" {
+			var pattern string
+			if json.Unmarshal(raw, &pattern) != nil || setScheduleTime(s, pattern, attr == "time", loc) != 0 {
+				errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+			}
+			continue
+		}
+		if _, errType := parseScheduleAttribute(s, attr, raw); errType != 0 {
+			errors = append(errors, scheduleError(errType, address, attr, raw))
+		}
+	}
+	if len(errors) > 0 {
+		writeJSON(w, errors)
+		return
+	}
+	if _, exists := body["autodelete"]; !exists && s.pattern.kind == patternRecurring {
+		s.AutoDelete = false
+	}
+
+	bridge.mu.Lock()
+	if len(bridge.schedules) >= bridge.limits.Schedules {
+		bridge.mu.Unlock()
+		writeJSON(w, []interface{}{newAPIError(errScheduleListFull, "/schedules")})
+		return
+	}
+	bridge.startScheduleLocked(s, now, loc)
+	if s.Status == scheduleEnabled && s.next.IsZero() {
+		bridge.mu.Unlock()
+		writeJSON(w, []interface{}{newAPIError(errScheduleTimeInPast, "/schedules/localtime")})
+		return
+	}
+	id := bridge.nextScheduleIDLocked()
+	bridge.schedules[id] = s
+	bridge.mu.Unlock()
+	bridge.startScheduler()
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"id": id}}})
+
+	log.Printf("Schedule %s created: %q at %s", id, s.Name, s.LocalTime)
+}
+
+// handleUpdateSchedule handles PUT /schedules/<id>. Changing the time
+// pattern or enabling the schedule restarts it, including timers.
+func handleUpdateSchedule(w http.ResponseWriter, r *http.Request, scheduleID string, bridge *HueBridge) {
+	address := "/schedules/" + scheduleID
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+	_, hasLocalTime := body["localtime"]
+	_, hasTime := body["time"]
+	if hasLocalTime && hasTime {
+		writeJSON(w, []interface{}{newAPIError(errScheduleTimeConflict, address)})
+		return
+	}
+
+	now, loc := bridge.Now(), bridge.location()
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	s, exists := bridge.schedules[scheduleID]
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+
+	// Changes are made on a copy so that a schedule left in the past can be
+	// rejected as a whole
+	updated := *s
+	restart := false
+	var responses []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		attrAddress := address + "/" + attr
+		switch attr {
+		case "localtime", "time":
+			var pattern string
+			if json.Unmarshal(raw, &pattern) != nil || setScheduleTime(&updated, pattern, attr == "time", loc) != 0 {
+				responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), attr))
+				continue
+			}
+			restart = true
+			responses = append(responses, newSuccess(attrAddress, pattern))
+		case "created", "starttime":
+			responses = append(responses, newAPIError(errParameterNotModifiable, attrAddress, attr))
+		default:
+			value, errType := parseScheduleAttribute(&updated, attr, raw)
+			if errType != 0 {
+				responses = append(responses, scheduleError(errType, attrAddress, attr, raw))
+				continue
+			}
+			if attr == "status" {
+				restart = true
+			}
+			responses = append(responses, newSuccess(attrAddress, value))
+		}
+	}
+
+	if restart {
+		bridge.startScheduleLocked(&updated, now, loc)
+		if updated.Status == scheduleEnabled && updated.next.IsZero() {
+			writeJSON(w, []interface{}{newAPIError(errScheduleTimeInPast, address+"/localtime")})
+			return
+		}
+	}
+	*s = updated
+
+	writeJSON(w, responses)
+}
+
+func handleDeleteSchedule(w http.ResponseWriter, _ *http.Request, scheduleID string, bridge *HueBridge) {
+	address := "/schedules/" + scheduleID
+
+	bridge.mu.Lock()
+	exists := bridge.deleteResourceLocked(address)
+	bridge.mu.Unlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+	writeJSON(w, []interface{}{map[string]interface{}{"success": address + " deleted"}})
+
+	log.Printf("Schedule %s deleted", scheduleID)
+}
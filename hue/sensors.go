@@ -0,0 +1,547 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Sensor is a v1 sensor. Its state and config attributes depend on its type.
+type Sensor struct {
+	Name             string                 `json:"name"`
+	Type             string                 `json:"type"`
+	ModelID          string                 `json:"modelid"`
+	ManufacturerName string                 `json:"manufacturername"`
+	SWVersion        string                 `json:"swversion"`
+	UniqueID         string                 `json:"uniqueid,omitempty"`
+	State            map[string]interface{} `json:"state"`
+	Config           map[string]interface{} `json:"config"`
+	Recycle          bool                   `json:"recycle,omitempty"`
+}
+
+// Kinds of sensor attribute values
+const (
+	boolAttribute = iota
+	intAttribute
+	stringAttribute
+)
+
+// sensorAttribute describes a state or config attribute of a sensor type
+type sensorAttribute struct {
+	name string
+	kind int
+	// initial is the value of a new sensor, nil for e.g. the buttonevent of
+	// a switch that was never pressed
+	initial interface{}
+	// writable is set for attributes applications can change
+	writable bool
+}
+
+// decode decodes raw as a value of the attribute
+func (a sensorAttribute) decode(raw json.RawMessage) (interface{}, bool) {
+	var err error
+	switch a.kind {
+	case boolAttribute:
+		var v bool
+		err = json.Unmarshal(raw, &v)
+		return v, err == nil
+	case intAttribute:
+		var v int
+		err = json.Unmarshal(raw, &v)
+		return v, err == nil
+	}
+	var v string
+	err = json.Unmarshal(raw, &v)
+	return v, err == nil
+}
+
+// sensorType describes a type of sensor
+type sensorType struct {
+	modelID      string
+	manufacturer string
+	swVersion    string
+	// cluster is the ZigBee cluster suffix of the unique ID, if any
+	cluster string
+	// clip is set for sensors created and updated by applications
+	clip   bool
+	state  []sensorAttribute
+	config []sensorAttribute
+}
+
+// Attributes shared by the sensor types
+var (
+	attrOn          = sensorAttribute{"on", boolAttribute, true, true}
+	attrReachable   = sensorAttribute{"reachable", boolAttribute, true, false}
+	attrBattery     = sensorAttribute{"battery", intAttribute, 100, false}
+	attrAlert       = sensorAttribute{"alert", stringAttribute, "none", true}
+	attrLED         = sensorAttribute{"ledindication", boolAttribute, false, true}
+	attrUserTest    = sensorAttribute{"usertest", boolAttribute, false, true}
+	attrButtonEvent = sensorAttribute{"buttonevent", intAttribute, nil, false}
+	attrClipOn      = sensorAttribute{"on", boolAttribute, true, true}
+	attrClipReach   = sensorAttribute{"reachable", boolAttribute, true, true}
+	attrClipBattery = sensorAttribute{"battery", intAttribute, 100, true}
+	attrClipURL     = sensorAttribute{"url", stringAttribute, "", true}
+)
+
+// sensorTypes lists the supported sensor types. A motion sensor appears as
+// three sensors: ZLLPresence, ZLLLightLevel and ZLLTemperature.
+var sensorTypes = map[string]sensorType{
+	"ZLLSwitch": {
+		modelID: "RWL021", manufacturer: "Signify Netherlands B.V.", swVersion: "6.1.1.28573", cluster: "02-fc00",
+		state:  []sensorAttribute{attrButtonEvent},
+		config: []sensorAttribute{attrOn, attrBattery, attrReachable},
+	},
+	"ZGPSwitch": {
+		modelID: "ZGPSWITCH", manufacturer: "Philips", swVersion: "", cluster: "f2",
+		state:  []sensorAttribute{attrButtonEvent},
+		config: []sensorAttribute{attrOn},
+	},
+	"ZLLPresence": {
+		modelID: "SML001", manufacturer: "Signify Netherlands B.V.", swVersion: "6.1.1.27575", cluster: "02-0406",
+		state: []sensorAttribute{{"presence", boolAttribute, false, false}},
+		config: []sensorAttribute{attrOn, attrBattery, attrReachable, attrAlert, attrLED, attrUserTest,
+			{"sensitivity", intAttribute, 2, true}, {"sensitivitymax", intAttribute, 2, false}},
+	},
+	"ZLLLightLevel": {
+		modelID: "SML001", manufacturer: "Signify Netherlands B.V.", swVersion: "6.1.1.27575", cluster: "02-0400",
+		state: []sensorAttribute{{"lightlevel", intAttribute, 0, false}, {"dark", boolAttribute, true, false},
+			{"daylight", boolAttribute, false, false}},
+		config: []sensorAttribute{attrOn, attrBattery, attrReachable, attrAlert, attrLED, attrUserTest,
+			{"tholddark", intAttribute, 16000, true}, {"tholdoffset", intAttribute, 7000, true}},
+	},
+	"ZLLTemperature": {
+		modelID: "SML001", manufacturer: "Signify Netherlands B.V.", swVersion: "6.1.1.27575", cluster: "02-0402",
+		state:  []sensorAttribute{{"temperature", intAttribute, 2000, false}}, // in hundredths of a degree Celsius
+		config: []sensorAttribute{attrOn, attrBattery, attrReachable, attrAlert, attrLED, attrUserTest},
+	},
+	"Daylight": {
+		modelID: "PHDL00", manufacturer: "Signify Netherlands B.V.", swVersion: "1.0",
+		state: []sensorAttribute{{"daylight", boolAttribute, nil, false}},
+		config: []sensorAttribute{attrOn, {"configured", boolAttribute, false, false},
+			{"sunriseoffset", intAttribute, 30, true}, {"sunsetoffset", intAttribute, -30, true},
+			{"long", stringAttribute, "none", true}, {"lat", stringAttribute, "none", true}},
+	},
+	"CLIPGenericStatus": {
+		clip:   true,
+		state:  []sensorAttribute{{"status", intAttribute, 0, true}},
+		config: []sensorAttribute{attrClipOn, attrClipReach, attrClipBattery, attrClipURL},
+	},
+	"CLIPGenericFlag": {
+		clip:   true,
+		state:  []sensorAttribute{{"flag", boolAttribute, false, true}},
+		config: []sensorAttribute{attrClipOn, attrClipReach, attrClipBattery, attrClipURL},
+	},
+}
+
+// attribute returns the attribute called name in attrs
+func attribute(attrs []sensorAttribute, name string) (sensorAttribute, bool) {
+	for _, a := range attrs {
+		if a.name == name {
+			return a, true
+		}
+	}
+	return sensorAttribute{}, false
+}
+
+// newSensor returns a sensor of the given type with its initial state and
+// config, or false if the type is not supported
+func newSensor(sensorTypeName, name string, n int) (*Sensor, bool) {
+	t, exists := sensorTypes[sensorTypeName]
+	if !exists {
+		return nil, false
+	}
+	sensor := &Sensor{
+		Name:             name,
+		Type:             sensorTypeName,
+		ModelID:          t.modelID,
+		ManufacturerName: t.manufacturer,
+		SWVersion:        t.swVersion,
+		State:            map[string]interface{}{"lastupdated": "none"},
+		Config:           make(map[string]interface{}),
+	}
+	if t.cluster != "" {
+		sensor.UniqueID = fmt.Sprintf("00:17:88:01:02:00:%02x:%02x-%s", (n>>8)&0xFF, n&0xFF, t.cluster)
+	}
+	for _, a := range t.state {
+		sensor.State[a.name] = a.initial
+	}
+	for _, a := range t.config {
+		sensor.Config[a.name] = a.initial
+	}
+	return sensor, true
+}
+
+// daylightSensor returns the built-in Daylight sensor every bridge has as
+// sensor 1
+func daylightSensor() *Sensor {
+	sensor, _ := newSensor("Daylight", "Daylight", 1)
+	return sensor
+}
+
+// copySensor returns a copy of s that does not share its state and config
+func copySensor(s *Sensor) Sensor {
+	c := *s
+	c.State = make(map[string]interface{}, len(s.State))
+	for k, v := range s.State {
+		c.State[k] = v
+	}
+	c.Config = make(map[string]interface{}, len(s.Config))
+	for k, v := range s.Config {
+		c.Config[k] = v
+	}
+	return c
+}
+
+// CreateSensor adds a sensor of the given type, e.g. "ZLLSwitch" for a
+// dimmer switch, and returns its v1 ID. It returns an error if the type is
+// not supported or the sensor limit is reached.
+func (b *HueBridge) CreateSensor(sensorTypeName, name string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.sensors) >= b.limits.Sensors {
+		return "", fmt.Errorf("sensor list is full (%d sensors)", b.limits.Sensors)
+	}
+	id := b.nextSensorIDLocked()
+	n, _ := strconv.Atoi(id)
+	sensor, ok := newSensor(sensorTypeName, name, n)
+	if !ok {
+		return "", fmt.Errorf("unknown sensor type %q", sensorTypeName)
+	}
+	if sensor.Name == "" {
+		sensor.Name = fmt.Sprintf("%s %s", sensorTypeName, id)
+	}
+	b.sensors[id] = sensor
+	return id, nil
+}
+
+// UpdateSensorState changes attributes of the state of a sensor as the
+// physical device would, e.g. {"buttonevent": 1002} for a short press of
+// the first button of a dimmer switch or {"presence": true} for motion.
+// Unlike through the v1 API, any attribute of the type can be set. It
+// returns an error for unknown sensors, attributes or invalid values.
+func (b *HueBridge) UpdateSensorState(id string, state map[string]json.RawMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sensor, exists := b.sensors[id]
+	if !exists {
+		return fmt.Errorf("sensor %s not found", id)
+	}
+	t := sensorTypes[sensor.Type]
+	values := make(map[string]interface{}, len(state))
+	for _, name := range sortedKeys(state) {
+		a, known := attribute(t.state, name)
+		if !known {
+			return fmt.Errorf("sensor %s has no state attribute %s", id, name)
+		}
+		v, ok := a.decode(state[name])
+		if !ok {
+			return fmt.Errorf("invalid value %s for state attribute %s", state[name], name)
+		}
+		values[name] = v
+	}
+	b.setSensorStateLocked(sensor, values)
+	return nil
+}
+
+// setSensorStateLocked applies state values to sensor and updates its
+// lastupdated time; b.mu must be held
+func (b *HueBridge) setSensorStateLocked(sensor *Sensor, values map[string]interface{}) {
+	for name, v := range values {
+		sensor.State[name] = v
+	}
+	if level, ok := values["lightlevel"].(int); ok && sensor.Type == "ZLLLightLevel" {
+		// Derive dark and daylight from the thresholds of the sensor
+		dark, _ := sensor.Config["tholddark"].(int)
+		offset, _ := sensor.Config["tholdoffset"].(int)
+		sensor.State["dark"] = level <= dark
+		sensor.State["daylight"] = level >= dark+offset
+	}
+	sensor.State["lastupdated"] = b.Now().UTC().Format(timeLayout)
+}
+
+// v1Sensors returns all sensors keyed by their v1 ID
+func (b *HueBridge) v1Sensors() map[string]Sensor {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	sensors := make(map[string]Sensor, len(b.sensors))
+	for id, sensor := range b.sensors {
+		sensors[id] = copySensor(sensor)
+	}
+	return sensors
+}
+
+// nextSensorIDLocked returns the lowest free sensor ID; b.mu must be held
+func (b *HueBridge) nextSensorIDLocked() string {
+	for n := 1; ; n++ {
+		if _, exists := b.sensors[strconv.Itoa(n)]; !exists {
+			return strconv.Itoa(n)
+		}
+	}
+}
+
+func handleGetSensors(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.v1Sensors())
+}
+
+func handleGetSensor(w http.ResponseWriter, _ *http.Request, sensorID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	sensor, exists := bridge.sensors[sensorID]
+	var v Sensor
+	if exists {
+		v = copySensor(sensor)
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/sensors/"+sensorID, "/sensors/"+sensorID)})
+		return
+	}
+	writeJSON(w, v)
+}
+
+// handleCreateSensor handles POST /sensors. Applications can only create
+// CLIP sensors, which need the same identification as physical ones.
+func handleCreateSensor(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	body, ok := decodeBody(w, r, "/sensors")
+	if !ok {
+		return
+	}
+
+	for _, attr := range []string{"name", "modelid", "swversion", "type", "uniqueid", "manufacturername"} {
+		if _, exists := body[attr]; !exists {
+			writeJSON(w, []interface{}{newAPIError(errMissingParameters, "/sensors")})
+			return
+		}
+	}
+	var typeName string
+	if json.Unmarshal(body["type"], &typeName) != nil || !sensorTypes[typeName].clip {
+		writeJSON(w, []interface{}{newAPIError(errSensorTypeNotAllowed, "/sensors/type")})
+		return
+	}
+
+	sensor, _ := newSensor(typeName, "", 0)
+	t := sensorTypes[typeName]
+	var errors []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		address := "/sensors/" + attr
+		var field *string
+		switch attr {
+		case "type":
+			continue
+		case "name":
+			field = &sensor.Name
+		case "modelid":
+			field = &sensor.ModelID
+		case "swversion":
+			field = &sensor.SWVersion
+		case "uniqueid":
+			field = &sensor.UniqueID
+		case "manufacturername":
+			field = &sensor.ManufacturerName
+		case "recycle":
+			if json.Unmarshal(raw, &sensor.Recycle) != nil {
+				errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+			}
+			continue
+		case "state", "config":
+			attrs, values := t.state, sensor.State
+			if attr == "config" {
+				attrs, values = t.config, sensor.Config
+			}
+			var initial map[string]json.RawMessage
+			if json.Unmarshal(raw, &initial) != nil {
+				errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+				continue
+			}
+			for _, name := range sortedKeys(initial) {
+				a, known := attribute(attrs, name)
+				if !known {
+					errors = append(errors, newAPIError(errParameterNotAvailable, address+"/"+name, name))
+					continue
+				}
+				v, ok := a.decode(initial[name])
+				if !ok {
+					errors = append(errors, newAPIError(errInvalidValue, address+"/"+name, rawValue(initial[name]), name))
+					continue
+				}
+				values[name] = v
+			}
+			continue
+		default:
+			errors = append(errors, newAPIError(errParameterNotAvailable, address, attr))
+			continue
+		}
+		if json.Unmarshal(raw, field) != nil || *field == "" || len(*field) > 32 {
+			errors = append(errors, newAPIError(errInvalidValue, address, rawValue(raw), attr))
+		}
+	}
+	if len(errors) > 0 {
+		writeJSON(w, errors)
+		return
+	}
+
+	bridge.mu.Lock()
+	if len(bridge.sensors) >= bridge.limits.Sensors {
+		bridge.mu.Unlock()
+		writeJSON(w, []interface{}{newAPIError(errSensorListFull, "/sensors")})
+		return
+	}
+	id := bridge.nextSensorIDLocked()
+	bridge.sensors[id] = sensor
+	bridge.mu.Unlock()
+
+	writeJSON(w, []interface{}{map[string]interface{}{"success": map[string]string{"id": id}}})
+
+	log.Printf("Sensor %s created: %s %q", id, sensor.Type, sensor.Name)
+}
+
+// handleUpdateSensor handles PUT /sensors/<id>, which renames the sensor
+func handleUpdateSensor(w http.ResponseWriter, r *http.Request, sensorID string, bridge *HueBridge) {
+	address := "/sensors/" + sensorID
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	sensor, exists := bridge.sensors[sensorID]
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+
+	var responses []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		attrAddress := address + "/" + attr
+		switch attr {
+		case "name":
+			var name string
+			if json.Unmarshal(raw, &name) != nil || name == "" || len(name) > 32 {
+				responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), attr))
+				continue
+			}
+			sensor.Name = name
+			responses = append(responses, newSuccess(attrAddress, name))
+		case "type", "modelid", "swversion", "uniqueid", "manufacturername", "recycle":
+			responses = append(responses, newAPIError(errParameterNotModifiable, attrAddress, attr))
+		default:
+			responses = append(responses, newAPIError(errParameterNotAvailable, attrAddress, attr))
+		}
+	}
+
+	writeJSON(w, responses)
+}
+
+// handleUpdateSensorAttributes handles PUT /sensors/<id>/config and
+// PUT /sensors/<id>/state. Only the state of CLIP sensors can be changed
+// through the API, physical sensors report their own.
+func handleUpdateSensorAttributes(w http.ResponseWriter, r *http.Request, sensorID, part string, bridge *HueBridge) {
+	address := "/sensors/" + sensorID + "/" + part
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+	sensor, exists := bridge.sensors[sensorID]
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/sensors/"+sensorID, "/sensors/"+sensorID)})
+		return
+	}
+
+	t := sensorTypes[sensor.Type]
+	attrs := t.config
+	if part == "state" {
+		attrs = t.state
+	}
+	var responses []interface{}
+	values := make(map[string]interface{})
+	for _, name := range sortedKeys(body) {
+		raw := body[name]
+		attrAddress := address + "/" + name
+		a, known := attribute(attrs, name)
+		switch {
+		case !known:
+			responses = append(responses, newAPIError(errParameterNotAvailable, attrAddress, name))
+		case !a.writable:
+			responses = append(responses, newAPIError(errParameterNotModifiable, attrAddress, name))
+		default:
+			v, ok := a.decode(raw)
+			if !ok {
+				responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), name))
+				continue
+			}
+			values[name] = v
+			responses = append(responses, newSuccess(attrAddress, v))
+		}
+	}
+
+	if part == "state" && len(values) > 0 {
+		bridge.setSensorStateLocked(sensor, values)
+	} else {
+		for name, v := range values {
+			sensor.Config[name] = v
+		}
+	}
+
+	writeJSON(w, responses)
+}
+
+func handleDeleteSensor(w http.ResponseWriter, _ *http.Request, sensorID string, bridge *HueBridge) {
+	address := "/sensors/" + sensorID
+
+	bridge.mu.Lock()
+	exists := bridge.deleteResourceLocked(address)
+	bridge.mu.Unlock()
+
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+	writeJSON(w, []interface{}{map[string]interface{}{"success": address + " deleted"}})
+
+	log.Printf("Sensor %s deleted", sensorID)
+}
+
+// handleAdminSensors serves /admin/sensors, which creates sensors of any
+// type and changes their state as the physical device would
+func handleAdminSensors(w http.ResponseWriter, r *http.Request, path string, bridge *HueBridge) {
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 1 && r.Method == "POST":
+		var body struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		id, err := bridge.CreateSensor(body.Type, body.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]string{"id": id})
+	case len(parts) == 3 && parts[2] == "state" && r.Method == "PUT":
+		var state map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := bridge.UpdateSensorState(parts[1], state); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handleGetSensor(w, r, parts[1], bridge)
+	default:
+		http.Error(w, "Unknown admin endpoint", http.StatusNotFound)
+	}
+}
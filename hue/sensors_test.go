@@ -0,0 +1,85 @@
+package hue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCreateCLIPSensor(t *testing.T) {
+	identity := `"modelid":"Flag","swversion":"1.0","uniqueid":"flag-1","manufacturername":"Test"`
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"flag", `{"name":"Flag","type":"CLIPGenericFlag",` + identity + `}`, `[{"success":{"id":"2"}}]`},
+		{"initial state", `{"name":"Status","type":"CLIPGenericStatus","state":{"status":3},` + identity + `}`, `[{"success":{"id":"2"}}]`},
+		{"missing identity", `{"name":"Flag","type":"CLIPGenericFlag"}`, `"type":5`},
+		{"physical type", `{"name":"Switch","type":"ZLLSwitch",` + identity + `}`, `"type":501`},
+		{"unknown state attribute", `{"name":"Flag","type":"CLIPGenericFlag","state":{"status":3},` + identity + `}`, `"type":6`},
+		{"invalid state value", `{"name":"Flag","type":"CLIPGenericFlag","state":{"flag":1},` + identity + `}`, `"type":7`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#sensors")
+			rec := serve(b.Handler(), "POST", "/api/owner/sensors", tt.body, "")
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("POST /sensors %s = %s, want %s", tt.body, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensorAttributes(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#sensors")
+	h := b.Handler()
+	switchID, err := b.CreateSensor("ZLLSwitch", "Dimmer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	presenceID, _ := b.CreateSensor("ZLLPresence", "Hall")
+	if _, err := b.CreateSensor("ZLLSmoke", "Kitchen"); err == nil {
+		t.Error("sensor of an unknown type created")
+	}
+
+	tests := []struct {
+		path, body string
+		want       string
+	}{
+		{"/api/owner/sensors/" + switchID + "/state", `{"buttonevent":1002}`, `"type":8`},
+		{"/api/owner/sensors/" + presenceID + "/config", `{"sensitivity":1}`, `[{"success":{"/sensors/` + presenceID + `/config/sensitivity":1}}]`},
+		{"/api/owner/sensors/" + presenceID + "/config", `{"sensitivitymax":5}`, `"type":8`},
+		{"/api/owner/sensors/" + presenceID + "/config", `{"sensitivity":"high"}`, `"type":7`},
+		{"/api/owner/sensors/" + presenceID + "/config", `{"color":"red"}`, `"type":6`},
+		{"/api/owner/sensors/" + presenceID, `{"name":"Stairs"}`, `[{"success":{"/sensors/` + presenceID + `/name":"Stairs"}}]`},
+		{"/api/owner/sensors/" + presenceID, `{"type":"ZLLSwitch"}`, `"type":8`},
+		{"/api/owner/sensors/9/state", `{"presence":true}`, `"type":3`},
+	}
+	for _, tt := range tests {
+		rec := serve(h, "PUT", tt.path, tt.body, "")
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("PUT %s %s = %s, want %s", tt.path, tt.body, rec.Body, tt.want)
+		}
+	}
+
+	// The physical device reports its own state
+	if err := b.UpdateSensorState(switchID, map[string]json.RawMessage{"buttonevent": json.RawMessage("1002")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateSensorState(switchID, map[string]json.RawMessage{"presence": json.RawMessage("true")}); err == nil {
+		t.Error("attribute of another sensor type updated")
+	}
+	var sensor Sensor
+	rec := serve(h, "GET", "/api/owner/sensors/"+switchID, "", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &sensor); err != nil {
+		t.Fatalf("GET = %s", rec.Body)
+	}
+	if sensor.State["buttonevent"] != 1002.0 || sensor.State["lastupdated"] == "none" {
+		t.Errorf("state = %v after a button press", sensor.State)
+	}
+}
@@ -0,0 +1,131 @@
+package hue
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Kinds of v1 time patterns
+const (
+	patternAbsolute  = iota // [YYYY]-[MM]-[DD]T[hh]:[mm]:[ss]
+	patternRecurring        // W[bbb]/T[hh]:[mm]:[ss]
+	patternTimer            // [R[nn]/]PT[hh]:[mm]:[ss]
+)
+
+// Time patterns, each optionally followed by A[hh]:[mm]:[ss] to randomize
+// the trigger time by up to the given duration
+var (
+	absolutePattern  = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})T(\d{2}):(\d{2}):(\d{2})(?:A(\d{2}):(\d{2}):(\d{2}))?$`)
+	recurringPattern = regexp.MustCompile(`^W(\d{1,3})/T(\d{2}):(\d{2}):(\d{2})(?:A(\d{2}):(\d{2}):(\d{2}))?$`)
+	timerPattern     = regexp.MustCompile(`^(?:R(\d{0,2})/)?PT(\d{2}):(\d{2}):(\d{2})(?:A(\d{2}):(\d{2}):(\d{2}))?$`)
+)
+
+// timePattern is a parsed v1 time pattern
+type timePattern struct {
+	kind int
+	// date is the date and time of absolute patterns, in local time
+	date time.Time
+	// weekdays is the bitmask of recurring patterns: 64 for Monday down to
+	// 1 for Sunday
+	weekdays int
+	// timeOfDay is the time of recurring patterns, or the duration of timers
+	timeOfDay time.Duration
+	// repeat is how many times a timer runs, -1 for forever
+	repeat int
+	// random is the maximum random delay added to every trigger
+	random time.Duration
+}
+
+// parseTimePattern parses a v1 time pattern. It returns false if pattern is
+// not valid.
+func parseTimePattern(pattern string) (timePattern, bool) {
+	if m := absolutePattern.FindStringSubmatch(pattern); m != nil {
+		n := atois(m[1:7])
+		date := time.Date(n[0], time.Month(n[1]), n[2], n[3], n[4], n[5], 0, time.UTC)
+		if date.Month() != time.Month(n[1]) || date.Day() != n[2] || n[3] > 23 || n[4] > 59 || n[5] > 59 {
+			return timePattern{}, false
+		}
+		random, ok := parseHMS(m[7:10])
+		return timePattern{kind: patternAbsolute, date: date, random: random}, ok
+	}
+	if m := recurringPattern.FindStringSubmatch(pattern); m != nil {
+		weekdays, _ := strconv.Atoi(m[1])
+		at, ok := parseHMS(m[2:5])
+		random, okRandom := parseHMS(m[5:8])
+		valid := ok && okRandom && weekdays >= 1 && weekdays <= 127 && at < 24*time.Hour
+		return timePattern{kind: patternRecurring, weekdays: weekdays, timeOfDay: at, random: random}, valid
+	}
+	if m := timerPattern.FindStringSubmatch(pattern); m != nil {
+		repeat := 1
+		if m[0][0] == 'R' {
+			repeat = -1
+			if m[1] != "" {
+				repeat, _ = strconv.Atoi(m[1])
+			}
+		}
+		duration, ok := parseHMS(m[2:5])
+		random, okRandom := parseHMS(m[5:8])
+		valid := ok && okRandom && duration > 0 && repeat != 0
+		return timePattern{kind: patternTimer, timeOfDay: duration, repeat: repeat, random: random}, valid
+	}
+	return timePattern{}, false
+}
+
+// parseHMS parses optional hours, minutes and seconds submatches
+func parseHMS(m []string) (time.Duration, bool) {
+	if m[0] == "" {
+		return 0, true
+	}
+	n := atois(m)
+	if n[1] > 59 || n[2] > 59 {
+		return 0, false
+	}
+	return time.Duration(n[0])*time.Hour + time.Duration(n[1])*time.Minute + time.Duration(n[2])*time.Second, true
+}
+
+// atois converts submatches of digits to integers
+func atois(m []string) []int {
+	n := make([]int, len(m))
+	for i, s := range m {
+		n[i], _ = strconv.Atoi(s)
+	}
+	return n
+}
+
+// weekdayBit returns the bit of a weekday in a recurring pattern
+func weekdayBit(d time.Weekday) int {
+	return 1 << ((7 - int(d)) % 7)
+}
+
+// next returns the first trigger time of the pattern after the given time,
+// in the timezone loc. Timers count from start. It returns the zero time if
+// the pattern does not trigger anymore.
+func (p timePattern) next(after, start time.Time, loc *time.Location) time.Time {
+	var t time.Time
+	switch p.kind {
+	case patternAbsolute:
+		t = time.Date(p.date.Year(), p.date.Month(), p.date.Day(), p.date.Hour(), p.date.Minute(), p.date.Second(), 0, loc)
+		if !t.After(after) {
+			return time.Time{}
+		}
+	case patternRecurring:
+		local := after.In(loc)
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		for i := 0; i <= 7; i++ {
+			day := midnight.AddDate(0, 0, i)
+			candidate := day.Add(p.timeOfDay)
+			if p.weekdays&weekdayBit(day.Weekday()) != 0 && candidate.After(after) {
+				t = candidate
+				break
+			}
+		}
+	case patternTimer:
+		t = start.Add(p.timeOfDay)
+	}
+	if p.random > 0 {
+		t = t.Add(time.Duration(rand.Int63n(int64(p.random) + 1)))
+	}
+	return t
+}
@@ -0,0 +1,85 @@
+package hue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    timePattern
+		ok      bool
+	}{
+		{"2026-01-31T07:00:00", timePattern{kind: patternAbsolute, date: time.Date(2026, 1, 31, 7, 0, 0, 0, time.UTC)}, true},
+		{"2026-01-31T07:00:00A00:30:00", timePattern{kind: patternAbsolute, date: time.Date(2026, 1, 31, 7, 0, 0, 0, time.UTC), random: 30 * time.Minute}, true},
+		{"W124/T07:00:00", timePattern{kind: patternRecurring, weekdays: 124, timeOfDay: 7 * time.Hour}, true},
+		{"PT00:10:00", timePattern{kind: patternTimer, timeOfDay: 10 * time.Minute, repeat: 1}, true},
+		{"R05/PT00:00:30", timePattern{kind: patternTimer, timeOfDay: 30 * time.Second, repeat: 5}, true},
+		{"R/PT01:00:00", timePattern{kind: patternTimer, timeOfDay: time.Hour, repeat: -1}, true},
+		{"2026-02-30T07:00:00", timePattern{}, false},
+		{"2026-01-31T24:00:00", timePattern{}, false},
+		{"2026-01-31T07:00:00A00:60:00", timePattern{}, false},
+		{"W0/T07:00:00", timePattern{}, false},
+		{"W128/T07:00:00", timePattern{}, false},
+		{"W124/T24:00:00", timePattern{}, false},
+		{"PT00:00:00", timePattern{}, false},
+		{"PT00:60:00", timePattern{}, false},
+		{"R00/PT00:10:00", timePattern{}, false},
+		{"T07:00:00", timePattern{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, ok := parseTimePattern(tt.pattern)
+			if ok != tt.ok {
+				t.Fatalf("parseTimePattern(%q) ok = %v, want %v", tt.pattern, ok, tt.ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("parseTimePattern(%q) = %+v, want %+v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimePatternNext(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	// Saturday 31 January 2026, 08:00 UTC
+	saturday := time.Date(2026, 1, 31, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		pattern string
+		after   time.Time
+		loc     *time.Location
+		want    time.Time
+	}{
+		{"absolute", "2026-02-01T07:00:00", saturday, time.UTC, time.Date(2026, 2, 1, 7, 0, 0, 0, time.UTC)},
+		{"absolute in local time", "2026-02-01T07:00:00", saturday, cet, time.Date(2026, 2, 1, 6, 0, 0, 0, time.UTC)},
+		{"absolute in the past", "2026-01-31T07:00:00", saturday, time.UTC, time.Time{}},
+		{"later today", "W127/T09:00:00", saturday, time.UTC, time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC)},
+		{"passed today", "W127/T08:00:00", saturday, time.UTC, time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{"weekdays from a Saturday", "W124/T07:00:00", saturday, time.UTC, time.Date(2026, 2, 2, 7, 0, 0, 0, time.UTC)},
+		{"Saturday only", "W2/T07:00:00", saturday, time.UTC, time.Date(2026, 2, 7, 7, 0, 0, 0, time.UTC)},
+		{"recurring in local time", "W127/T08:30:00", saturday, cet, time.Date(2026, 2, 1, 7, 30, 0, 0, time.UTC)},
+		{"timer", "PT00:10:00", saturday, time.UTC, saturday.Add(10 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := parseTimePattern(tt.pattern)
+			if !ok {
+				t.Fatalf("parseTimePattern(%q) failed", tt.pattern)
+			}
+			if got := p.next(tt.after, tt.after, tt.loc); !got.Equal(tt.want) {
+				t.Errorf("next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A random delay stays within its bound
+	p, _ := parseTimePattern("PT00:10:00A00:05:00")
+	for i := 0; i < 20; i++ {
+		got := p.next(saturday, saturday, time.UTC)
+		if got.Before(saturday.Add(10*time.Minute)) || got.After(saturday.Add(15*time.Minute)) {
+			t.Fatalf("randomized next = %v, want within 5 minutes after %v", got, saturday.Add(10*time.Minute))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package hue
+
+import (
+	"math"
+	"time"
+)
+
+// defaultTransitionTime is the transition applied by the bridge when a state
+// update does not specify one, in deciseconds (400ms).
+const defaultTransitionTime = 4
+
+// transition is an in-progress fade of a light between two states
+type transition struct {
+	from, to LightState
+	start    time.Time
+	duration time.Duration
+}
+
+// at returns the interpolated state at the given time and whether the
+// transition is still running.
+func (t *transition) at(now time.Time) (LightState, bool) {
+	elapsed := now.Sub(t.start)
+	if elapsed >= t.duration {
+		return t.to, false
+	}
+	p := float64(elapsed) / float64(t.duration)
+
+	s := t.to
+	// A light fading in starts from black and one fading out stays on
+	// until it reaches black.
+	fromBri, toBri := effectiveBrightness(t.from), effectiveBrightness(t.to)
+	s.On = true
+	s.Brightness = uint8(math.Round(lerp(fromBri, toBri, p)))
+	s.Hue = lerpHue(t.from.Hue, t.to.Hue, p)
+	s.Saturation = uint8(math.Round(lerp(float64(t.from.Saturation), float64(t.to.Saturation), p)))
+	s.XY = [2]float64{
+		round4(lerp(t.from.XY[0], t.to.XY[0], p)),
+		round4(lerp(t.from.XY[1], t.to.XY[1], p)),
+	}
+	s.ColorTemp = uint16(math.Round(lerp(float64(t.from.ColorTemp), float64(t.to.ColorTemp), p)))
+	return s, true
+}
+
+// newTransition returns the transition from one state to another over
+// duration, or nil if the change should be applied instantly.
+func newTransition(from, to LightState, start time.Time, duration time.Duration) *transition {
+	if duration <= 0 || from == to || (!from.On && !to.On) {
+		return nil
+	}
+	return &transition{from: from, to: to, start: start, duration: duration}
+}
+
+// transitionDuration converts a v1 transitiontime in deciseconds, falling
+// back to the bridge default when it is not set.
+func transitionDuration(transitionTime *uint16) time.Duration {
+	if transitionTime == nil {
+		return defaultTransitionTime * 100 * time.Millisecond
+	}
+	return time.Duration(*transitionTime) * 100 * time.Millisecond
+}
+
+func effectiveBrightness(s LightState) float64 {
+	if !s.On {
+		return 0
+	}
+	return float64(s.Brightness)
+}
+
+func lerp(a, b, p float64) float64 {
+	return a + (b-a)*p
+}
+
+// lerpHue interpolates between two hues along the shortest way around the
+// color wheel.
+func lerpHue(a, b uint16, p float64) uint16 {
+	d := float64(b) - float64(a)
+	if d > 32768 {
+		d -= 65536
+	} else if d < -32768 {
+		d += 65536
+	}
+	h := math.Round(float64(a) + d*p)
+	return uint16(int64(h) & 0xFFFF)
+}
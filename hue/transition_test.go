@@ -0,0 +1,86 @@
+package hue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransitionAt(t *testing.T) {
+	start := time.Date(2026, 1, 31, 8, 0, 0, 0, time.UTC)
+	state := func(on bool, bri uint8, hue uint16) LightState {
+		return LightState{On: on, Brightness: bri, Hue: hue, XY: [2]float64{0.3, 0.3}, ColorTemp: 153}
+	}
+	tests := []struct {
+		name    string
+		from    LightState
+		to      LightState
+		elapsed time.Duration
+		want    LightState
+		running bool
+	}{
+		{"halfway", state(true, 100, 0), state(true, 200, 0), 500 * time.Millisecond, state(true, 150, 0), true},
+		{"fade in from black", state(false, 200, 0), state(true, 200, 0), 250 * time.Millisecond, state(true, 50, 0), true},
+		{"fade out stays on", state(true, 200, 0), state(false, 200, 0), 250 * time.Millisecond, state(true, 150, 0), true},
+		{"hue the short way", state(true, 100, 65000), state(true, 100, 1000), 500 * time.Millisecond, state(true, 100, 232), true},
+		{"done", state(true, 100, 0), state(false, 200, 0), time.Second, state(false, 200, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTransition(tt.from, tt.to, start, time.Second)
+			got, running := tr.at(start.Add(tt.elapsed))
+			if got != tt.want || running != tt.running {
+				t.Errorf("at(%v) = %+v, %v, want %+v, %v", tt.elapsed, got, running, tt.want, tt.running)
+			}
+		})
+	}
+}
+
+func TestNewTransition(t *testing.T) {
+	on := LightState{On: true, Brightness: 100}
+	brighter := LightState{On: true, Brightness: 200}
+	tests := []struct {
+		name     string
+		from, to LightState
+		duration time.Duration
+		want     bool
+	}{
+		{"fade", on, brighter, time.Second, true},
+		{"instant", on, brighter, 0, false},
+		{"unchanged", on, on, time.Second, false},
+		{"off to off", LightState{Brightness: 100}, LightState{Brightness: 200}, time.Second, false},
+	}
+	for _, tt := range tests {
+		if got := newTransition(tt.from, tt.to, time.Now(), tt.duration) != nil; got != tt.want {
+			t.Errorf("%s: transition = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionTime(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#transitions")
+	b.CreateLight(1)
+	light, _ := b.Light("1")
+	h := b.Handler()
+
+	tests := []struct {
+		body    string
+		running bool
+	}{
+		{`{"on":true,"bri":100,"transitiontime":0}`, false},
+		{`{"bri":200,"transitiontime":50}`, true},
+		{`{"bri":10}`, true},
+	}
+	for _, tt := range tests {
+		serve(h, "PUT", "/api/owner/lights/1/state", tt.body, "")
+		// The target state is reported right away
+		rendered, running := light.Rendered()
+		if running != tt.running || (running && rendered == light.Snapshot()) {
+			t.Errorf("%s: rendered %+v, running %v, want running %v", tt.body, rendered, running, tt.running)
+		}
+	}
+	if bri := light.Snapshot().Brightness; bri != 10 {
+		t.Errorf("bri = %d, want 10", bri)
+	}
+}
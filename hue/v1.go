@@ -0,0 +1,452 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+func handleHueAPI(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/")
+
+	// Pairing: POST /api
+	if path == "" {
+		if r.Method == "POST" {
+			handleCreateUser(w, r, bridge)
+		} else {
+			writeJSON(w, []interface{}{newAPIError(errMethodNotAvailable, "/", r.Method, "/")})
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	resource := "/" + strings.Join(parts[1:], "/")
+
+	// The short configuration is readable without a user, either through
+	// /api/config or /api/<unknown user>/config
+	if path == "config" && r.Method == "GET" {
+		handleGetShortConfig(w, r, bridge)
+		return
+	}
+	if !bridge.authorize(parts[0]) {
+		if resource == "/config" && r.Method == "GET" {
+			handleGetShortConfig(w, r, bridge)
+			return
+		}
+		writeJSON(w, []interface{}{newAPIError(errUnauthorizedUser, resource)})
+		return
+	}
+
+	// Handle different API endpoints
+	switch {
+	case resource == "/" && r.Method == "GET":
+		handleGetDatastore(w, r, bridge)
+	case resource == "/config" && r.Method == "GET":
+		handleGetConfig(w, r, bridge)
+	case resource == "/config" && r.Method == "PUT":
+		handleUpdateConfig(w, r, bridge)
+	case len(parts) == 2 && parts[1] == "lights" && r.Method == "GET":
+		handleGetLights(w, r, bridge)
+	case len(parts) == 2 && parts[1] == "lights" && r.Method == "POST":
+		handleSearchLights(w, r, bridge)
+	case len(parts) == 3 && parts[1] == "lights" && parts[2] == "new" && r.Method == "GET":
+		handleGetNewLights(w, r, bridge)
+	case len(parts) == 3 && parts[1] == "lights" && r.Method == "GET":
+		handleGetLight(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "lights" && r.Method == "PUT":
+		handleUpdateLight(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "lights" && r.Method == "DELETE":
+		handleDeleteLight(w, r, parts[2], bridge)
+	case len(parts) == 4 && parts[1] == "lights" && parts[3] == "state" && r.Method == "PUT":
+		handleUpdateLightState(w, r, parts[2], bridge)
+	case len(parts) == 2 && parts[1] == "groups" && r.Method == "GET":
+		handleGetGroups(w, r, bridge)
+	case len(parts) == 2 && parts[1] == "groups" && r.Method == "POST":
+		handleCreateGroup(w, r, bridge)
+	case len(parts) == 3 && parts[1] == "groups" && r.Method == "GET":
+		handleGetGroup(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "groups" && r.Method == "PUT":
+		handleUpdateGroup(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "groups" && r.Method == "DELETE":
+		handleDeleteGroup(w, r, parts[2], bridge)
+	case len(parts) == 4 && parts[1] == "groups" && parts[3] == "action" && r.Method == "PUT":
+		handleGroupAction(w, r, parts[2], bridge)
+	case len(parts) == 2 && parts[1] == "scenes" && r.Method == "GET":
+		handleGetScenes(w, r, bridge)
+	case len(parts) == 2 && parts[1] == "scenes" && r.Method == "POST":
+		handleCreateScene(w, r, parts[0], bridge)
+	case len(parts) == 3 && parts[1] == "scenes" && r.Method == "GET":
+		handleGetScene(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "scenes" && r.Method == "PUT":
+		handleUpdateScene(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "scenes" && r.Method == "DELETE":
+		handleDeleteScene(w, r, parts[2], bridge)
+	case len(parts) == 5 && parts[1] == "scenes" && parts[3] == "lightstates" && r.Method == "PUT":
+		handleUpdateSceneLightState(w, r, parts[2], parts[4], bridge)
+	case len(parts) == 2 && parts[1] == "schedules" && r.Method == "GET":
+		handleGetSchedules(w, r, bridge)
+	case len(parts) == 2 && parts[1] == "schedules" && r.Method == "POST":
+		handleCreateSchedule(w, r, bridge)
+	case len(parts) == 3 && parts[1] == "schedules" && r.Method == "GET":
+		handleGetSchedule(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "schedules" && r.Method == "PUT":
+		handleUpdateSchedule(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "schedules" && r.Method == "DELETE":
+		handleDeleteSchedule(w, r, parts[2], bridge)
+	case len(parts) == 2 && parts[1] == "rules" && r.Method == "GET":
+		handleGetRules(w, r, bridge)
+	case len(parts) == 2 && parts[1] == "rules" && r.Method == "POST":
+		handleCreateRule(w, r, parts[0], bridge)
+	case len(parts) == 3 && parts[1] == "rules" && r.Method == "GET":
+		handleGetRule(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "rules" && r.Method == "PUT":
+		handleUpdateRule(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "rules" && r.Method == "DELETE":
+		handleDeleteRule(w, r, parts[2], bridge)
+	case len(parts) == 2 && parts[1] == "sensors" && r.Method == "GET":
+		handleGetSensors(w, r, bridge)
+	case len(parts) == 2 && parts[1] == "sensors" && r.Method == "POST":
+		handleCreateSensor(w, r, bridge)
+	case len(parts) == 3 && parts[1] == "sensors" && r.Method == "GET":
+		handleGetSensor(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "sensors" && r.Method == "PUT":
+		handleUpdateSensor(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "sensors" && r.Method == "DELETE":
+		handleDeleteSensor(w, r, parts[2], bridge)
+	case len(parts) == 4 && parts[1] == "sensors" && (parts[3] == "config" || parts[3] == "state") && r.Method == "PUT":
+		handleUpdateSensorAttributes(w, r, parts[2], parts[3], bridge)
+	case len(parts) == 2 && parts[1] == "resourcelinks" && r.Method == "GET":
+		handleGetResourceLinks(w, r, bridge)
+	case len(parts) == 2 && parts[1] == "resourcelinks" && r.Method == "POST":
+		handleCreateResourceLink(w, r, parts[0], bridge)
+	case len(parts) == 3 && parts[1] == "resourcelinks" && r.Method == "GET":
+		handleGetResourceLink(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "resourcelinks" && r.Method == "PUT":
+		handleUpdateResourceLink(w, r, parts[2], bridge)
+	case len(parts) == 3 && parts[1] == "resourcelinks" && r.Method == "DELETE":
+		handleDeleteResourceLink(w, r, parts[2], bridge)
+	case len(parts) == 2 && parts[1] == "capabilities" && r.Method == "GET":
+		handleGetCapabilities(w, r, bridge)
+	default:
+		writeJSON(w, []interface{}{newAPIError(errMethodNotAvailable, resource, r.Method, resource)})
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeBody decodes a v1 request body into a map of raw attributes. On
+// failure it writes the matching error response and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, address string) (map[string]json.RawMessage, bool) {
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, []interface{}{newAPIError(errInvalidJSON, "")})
+		return nil, false
+	}
+	if len(body) == 0 {
+		writeJSON(w, []interface{}{newAPIError(errMissingParameters, address)})
+		return nil, false
+	}
+	return body, true
+}
+
+func handleGetLights(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	writeJSON(w, bridge.v1Lights())
+}
+
+// v1Lights returns all lights keyed by their v1 ID
+func (b *HueBridge) v1Lights() map[string]*HueLight {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	lights := make(map[string]*HueLight, len(b.lights))
+	for id, light := range b.lights {
+		lights[id] = light
+	}
+	return lights
+}
+
+func handleGetLight(w http.ResponseWriter, _ *http.Request, lightID string, bridge *HueBridge) {
+	light, exists := bridge.Light(lightID)
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/lights/"+lightID, "/lights/"+lightID)})
+		return
+	}
+	writeJSON(w, light)
+}
+
+// handleUpdateLight handles PUT /lights/<id>, which renames the light
+func handleUpdateLight(w http.ResponseWriter, r *http.Request, lightID string, bridge *HueBridge) {
+	address := "/lights/" + lightID
+	light, exists := bridge.Light(lightID)
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	var responses []interface{}
+	for _, attr := range sortedKeys(body) {
+		raw := body[attr]
+		if attr != "name" {
+			responses = append(responses, newAPIError(errParameterNotAvailable, address+"/"+attr, attr))
+			continue
+		}
+		var name string
+		if json.Unmarshal(raw, &name) != nil || name == "" || len(name) > 32 {
+			responses = append(responses, newAPIError(errInvalidValue, address+"/name", rawValue(raw), "name"))
+			continue
+		}
+		light.rename(name)
+		responses = append(responses, newSuccess(address+"/name", name))
+	}
+
+	writeJSON(w, responses)
+}
+
+func handleDeleteLight(w http.ResponseWriter, _ *http.Request, lightID string, bridge *HueBridge) {
+	address := "/lights/" + lightID
+	if !bridge.DeleteLight(lightID) {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, address, address)})
+		return
+	}
+	writeJSON(w, []interface{}{map[string]interface{}{"success": address + " deleted"}})
+
+	log.Printf("Light %s deleted", lightID)
+}
+
+func handleUpdateLightState(w http.ResponseWriter, r *http.Request, lightID string, bridge *HueBridge) {
+	// Find the light
+	light, exists := bridge.Light(lightID)
+	if !exists {
+		writeJSON(w, []interface{}{newAPIError(errResourceNotAvailable, "/lights/"+lightID, "/lights/"+lightID)})
+		return
+	}
+
+	address := fmt.Sprintf("/lights/%s/state", lightID)
+	body, ok := decodeBody(w, r, address)
+	if !ok {
+		return
+	}
+
+	update, responses := parseStateUpdate(body, address, light.Snapshot().On, light.Capabilities)
+	bridge.lightsChanged([]*HueLight{light})
+	light.updateLightState(update)
+
+	writeJSON(w, responses)
+
+	log.Printf("Light %s updated: on=%v, bri=%v, hue=%v, sat=%v, xy=%v, ct=%v",
+		lightID, update.On, update.Brightness, update.Hue, update.Saturation, update.XY, update.ColorTemp)
+}
+
+// stateAttribute describes an attribute of a v1 light state update
+type stateAttribute struct {
+	name string
+	// needsOn is set for attributes that cannot be changed while the light is off
+	needsOn bool
+	// needsCT is set for color temperature attributes, which are not
+	// available on lights without color temperature support
+	needsCT bool
+	// parse decodes raw into the update and returns the value to report, or
+	// false if the value is invalid for the light
+	parse func(update *StateUpdate, raw json.RawMessage, caps LightCapabilities) (interface{}, bool)
+}
+
+// newStateAttribute returns a state attribute decoded as a T and stored in
+// the update field returned by field. check validates the decoded value and
+// returns it clamped to what the light supports.
+func newStateAttribute[T any](name string, needsOn bool, field func(*StateUpdate) **T, check func(T, LightCapabilities) (T, bool)) stateAttribute {
+	return stateAttribute{
+		name:    name,
+		needsOn: needsOn,
+		parse: func(update *StateUpdate, raw json.RawMessage, caps LightCapabilities) (interface{}, bool) {
+			var v T
+			if string(raw) == "null" || json.Unmarshal(raw, &v) != nil {
+				return nil, false
+			}
+			v, ok := check(v, caps)
+			if !ok {
+				return nil, false
+			}
+			*field(update) = &v
+			return v, true
+		},
+	}
+}
+
+// anyValue accepts every value of the attribute type
+func anyValue[T any](v T, _ LightCapabilities) (T, bool) {
+	return v, true
+}
+
+// intRange accepts values between lo and hi
+func intRange[T int16 | int32](lo, hi T) func(T, LightCapabilities) (T, bool) {
+	return func(v T, _ LightCapabilities) (T, bool) {
+		return v, v >= lo && v <= hi
+	}
+}
+
+// colorTemp marks a color temperature attribute
+func colorTemp(attr stateAttribute) stateAttribute {
+	attr.needsCT = true
+	return attr
+}
+
+// oneOf accepts the listed string values
+func oneOf(values ...string) func(string, LightCapabilities) (string, bool) {
+	return func(v string, _ LightCapabilities) (string, bool) {
+		for _, allowed := range values {
+			if v == allowed {
+				return v, true
+			}
+		}
+		return v, false
+	}
+}
+
+// stateAttributes lists the v1 light state attributes in the order their
+// results are reported.
+var stateAttributes = []stateAttribute{
+	newStateAttribute("on", false, func(u *StateUpdate) **bool { return &u.On }, anyValue[bool]),
+	newStateAttribute("bri", true, func(u *StateUpdate) **uint8 { return &u.Brightness },
+		func(v uint8, _ LightCapabilities) (uint8, bool) { return clampBrightness(int(v)), v <= 254 }),
+	newStateAttribute("hue", true, func(u *StateUpdate) **uint16 { return &u.Hue }, anyValue[uint16]),
+	newStateAttribute("sat", true, func(u *StateUpdate) **uint8 { return &u.Saturation },
+		func(v uint8, _ LightCapabilities) (uint8, bool) { return v, v <= 254 }),
+	newXYAttribute("xy", func(u *StateUpdate) **[2]float64 { return &u.XY }, 0, 1),
+	colorTemp(newStateAttribute("ct", true, func(u *StateUpdate) **uint16 { return &u.ColorTemp },
+		func(v uint16, caps LightCapabilities) (uint16, bool) { return caps.clampColorTemp(int(v)), true })),
+	newStateAttribute("alert", false, func(u *StateUpdate) **string { return &u.Alert }, oneOf("none", "select", "lselect")),
+	newStateAttribute("effect", true, func(u *StateUpdate) **string { return &u.Effect }, oneOf("none", "colorloop")),
+	newStateAttribute("transitiontime", false, func(u *StateUpdate) **uint16 { return &u.TransitionTime }, anyValue[uint16]),
+	newStateAttribute("bri_inc", true, func(u *StateUpdate) **int16 { return &u.BrightnessInc }, intRange[int16](-254, 254)),
+	newStateAttribute("sat_inc", true, func(u *StateUpdate) **int16 { return &u.SaturationInc }, intRange[int16](-254, 254)),
+	newStateAttribute("hue_inc", true, func(u *StateUpdate) **int32 { return &u.HueInc }, intRange[int32](-65534, 65534)),
+	colorTemp(newStateAttribute("ct_inc", true, func(u *StateUpdate) **int32 { return &u.ColorTempInc }, intRange[int32](-65534, 65534))),
+	newXYAttribute("xy_inc", func(u *StateUpdate) **[2]float64 { return &u.XYInc }, -0.5, 0.5),
+}
+
+// newXYAttribute returns an [x, y] state attribute whose coordinates must
+// be between lo and hi. It is decoded as a slice so that lists of the wrong
+// length are rejected.
+func newXYAttribute(name string, field func(*StateUpdate) **[2]float64, lo, hi float64) stateAttribute {
+	return stateAttribute{
+		name:    name,
+		needsOn: true,
+		parse: func(update *StateUpdate, raw json.RawMessage, _ LightCapabilities) (interface{}, bool) {
+			var xy []float64
+			if json.Unmarshal(raw, &xy) != nil || len(xy) != 2 {
+				return nil, false
+			}
+			if xy[0] < lo || xy[0] > hi || xy[1] < lo || xy[1] > hi {
+				return nil, false
+			}
+			*field(update) = &[2]float64{xy[0], xy[1]}
+			return xy, true
+		},
+	}
+}
+
+// parseStateUpdate decodes the attributes of a v1 state update addressed at
+// address. It returns the valid part of the update along with a success or
+// error entry for every attribute, as the bridge applies the valid
+// attributes even when others fail.
+func parseStateUpdate(body map[string]json.RawMessage, address string, isOn bool, caps LightCapabilities) (StateUpdate, []interface{}) {
+	var update StateUpdate
+	var responses []interface{}
+
+	known := make(map[string]bool, len(stateAttributes))
+	for _, attr := range stateAttributes {
+		known[attr.name] = true
+		raw, exists := body[attr.name]
+		if !exists {
+			continue
+		}
+		attrAddress := address + "/" + attr.name
+		if attr.needsCT && !caps.supportsColorTemp() {
+			responses = append(responses, newAPIError(errParameterNotAvailable, attrAddress, attr.name))
+			continue
+		}
+		if attr.needsOn && !isOn {
+			responses = append(responses, newAPIError(errDeviceIsOff, attrAddress, attr.name))
+			continue
+		}
+		value, ok := attr.parse(&update, raw, caps)
+		if !ok {
+			responses = append(responses, newAPIError(errInvalidValue, attrAddress, rawValue(raw), attr.name))
+			continue
+		}
+		if attr.name == "on" {
+			isOn = *update.On
+		}
+		responses = append(responses, newSuccess(attrAddress, value))
+	}
+
+	// Report unknown attributes in a stable order
+	var unknown []string
+	for name := range body {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		responses = append(responses, newAPIError(errParameterNotAvailable, address+"/"+name, name))
+	}
+
+	return update, responses
+}
+
+// sortedKeys returns the attribute names of a request body in a stable order
+func sortedKeys(body map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(body))
+	for key := range body {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rawValue renders a raw JSON value the way the bridge quotes it in error
+// descriptions, i.e. without the quotes of strings.
+func rawValue(raw json.RawMessage) string {
+	return strings.Trim(string(raw), `"`)
+}
+
+// handleDescription serves the UPnP description of the bridge, whose serial
+// number, UDN and model follow its configuration
+func handleDescription(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	config := bridge.Config()
+	description := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <specVersion>
+    <major>1</major>
+    <minor>0</minor>
+  </specVersion>
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>
+    <friendlyName>%s</friendlyName>
+    <manufacturer>Royal Philips Electronics</manufacturer>
+    <manufacturerURL>http://www.philips.com</manufacturerURL>
+    <modelDescription>Philips hue Personal Wireless Lighting</modelDescription>
+    <modelName>%s</modelName>
+    <modelNumber>%s</modelNumber>
+    <modelURL>http://www.meethue.com</modelURL>
+    <serialNumber>%s</serialNumber>
+    <UDN>%s</UDN>
+  </device>
+</root>`, html.EscapeString(config.Name), config.ModelName(), config.ModelID, config.SerialNumber(), config.UDN())
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(description))
+}
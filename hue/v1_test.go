@@ -0,0 +1,264 @@
+package hue
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve sends a request to the handler of a bridge as the application key,
+// which is sent as a CLIP v2 header when set
+func serve(h http.Handler, method, path, body, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("hue-application-key", key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestParseStateUpdate(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		isOn  bool
+		model string
+		want  []interface{}
+	}{
+		{
+			name:  "results in attribute order",
+			body:  `{"transitiontime":4,"bri":100,"on":true}`,
+			model: "LCT016",
+			want: []interface{}{
+				newSuccess("/lights/1/state/on", true),
+				newSuccess("/lights/1/state/bri", 100),
+				newSuccess("/lights/1/state/transitiontime", 4),
+			},
+		},
+		{
+			name:  "light off",
+			body:  `{"bri":100,"alert":"select"}`,
+			model: "LCT016",
+			want: []interface{}{
+				newAPIError(errDeviceIsOff, "/lights/1/state/bri", "bri"),
+				newSuccess("/lights/1/state/alert", "select"),
+			},
+		},
+		{
+			name:  "turned off by the update",
+			body:  `{"on":false,"bri":100}`,
+			isOn:  true,
+			model: "LCT016",
+			want: []interface{}{
+				newSuccess("/lights/1/state/on", false),
+				newAPIError(errDeviceIsOff, "/lights/1/state/bri", "bri"),
+			},
+		},
+		{
+			name:  "invalid values",
+			body:  `{"bri":255,"sat":255,"xy":[0.5],"alert":"blink","hue_inc":70000}`,
+			isOn:  true,
+			model: "LCT016",
+			want: []interface{}{
+				newAPIError(errInvalidValue, "/lights/1/state/bri", "255", "bri"),
+				newAPIError(errInvalidValue, "/lights/1/state/sat", "255", "sat"),
+				newAPIError(errInvalidValue, "/lights/1/state/xy", "[0.5]", "xy"),
+				newAPIError(errInvalidValue, "/lights/1/state/alert", "blink", "alert"),
+				newAPIError(errInvalidValue, "/lights/1/state/hue_inc", "70000", "hue_inc"),
+			},
+		},
+		{
+			name:  "unknown attributes sorted last",
+			body:  `{"zeta":1,"on":true,"alpha":2}`,
+			model: "LCT016",
+			want: []interface{}{
+				newSuccess("/lights/1/state/on", true),
+				newAPIError(errParameterNotAvailable, "/lights/1/state/alpha", "alpha"),
+				newAPIError(errParameterNotAvailable, "/lights/1/state/zeta", "zeta"),
+			},
+		},
+		{
+			name:  "ct clamped to the light",
+			body:  `{"ct":500}`,
+			isOn:  true,
+			model: "LTW001",
+			want:  []interface{}{newSuccess("/lights/1/state/ct", 454)},
+		},
+		{
+			name:  "ct without color temperature",
+			body:  `{"ct":300,"ct_inc":10}`,
+			model: "LLC010",
+			want: []interface{}{
+				newAPIError(errParameterNotAvailable, "/lights/1/state/ct", "ct"),
+				newAPIError(errParameterNotAvailable, "/lights/1/state/ct_inc", "ct_inc"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+				t.Fatal(err)
+			}
+			_, responses := parseStateUpdate(body, "/lights/1/state", tt.isOn, capabilitiesForModel(tt.model))
+			got, _ := json.Marshal(responses)
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("responses = %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestLightStateErrors(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		want               string
+	}{
+		{"PUT", "/api/owner/lights/3/state", `{"on":true}`, `[{"error":{"type":3,"address":"/lights/3","description":"resource, /lights/3, not available"}}]`},
+		{"PUT", "/api/owner/lights/1/state", `{"on":`, `[{"error":{"type":2,"address":"","description":"body contains invalid json"}}]`},
+		{"PUT", "/api/owner/lights/1/state", `{}`, `"type":5`},
+		{"POST", "/api/owner/lights/1/state", `{"on":true}`, `"type":4`},
+	}
+	for _, tt := range tests {
+		b := NewHueBridge(0)
+		b.AddUser("owner", "test#lights")
+		b.CreateLight(1)
+		rec := serve(b.Handler(), tt.method, tt.path, tt.body, "")
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s %s %s = %s, want %s", tt.method, tt.path, tt.body, rec.Body, tt.want)
+		}
+		b.Close()
+	}
+}
+
+func TestAlertEnd(t *testing.T) {
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#lights")
+	light, _ := b.CreateLight(1)
+	alert := func(v string) { light.updateLightState(StateUpdate{Alert: &v}) }
+
+	alert("lselect")
+	seq := light.alertSeq
+	alert("select")
+	// The end of an alert that was replaced leaves the new one running
+	light.endAlert(seq)
+	if got := light.Snapshot().Alert; got != "select" {
+		t.Errorf("alert = %q after the end of a replaced alert, want select", got)
+	}
+	light.endAlert(light.alertSeq)
+	if got := light.Snapshot().Alert; got != "none" {
+		t.Errorf("alert = %q after its end, want none", got)
+	}
+}
+
+func TestLightResource(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		want               string
+	}{
+		{"GET", "/api/owner/lights/1", "", `"name":"Fake Hue Light 1"`},
+		{"GET", "/api/owner/lights/3", "", `[{"error":{"type":3,"address":"/lights/3","description":"resource, /lights/3, not available"}}]`},
+		{"PUT", "/api/owner/lights/1", `{"name":"Desk"}`, `[{"success":{"/lights/1/name":"Desk"}}]`},
+		{"PUT", "/api/owner/lights/1", `{"name":""}`, `"type":7`},
+		{"PUT", "/api/owner/lights/1", `{"name":"` + strings.Repeat("a", 33) + `"}`, `"type":7`},
+		{"PUT", "/api/owner/lights/1", `{"type":"Dimmable light"}`, `"type":6`},
+		{"DELETE", "/api/owner/lights/2", "", `[{"success":"/lights/2 deleted"}]`},
+		{"DELETE", "/api/owner/lights/3", "", `"type":3`},
+	}
+	for _, tt := range tests {
+		b := NewHueBridge(0)
+		b.AddUser("owner", "test#lights")
+		b.CreateLight(1)
+		b.CreateLight(2)
+		rec := serve(b.Handler(), tt.method, tt.path, tt.body, "")
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s %s %s = %s, want %s", tt.method, tt.path, tt.body, rec.Body, tt.want)
+		}
+		b.Close()
+	}
+
+	// Renamed and deleted lights show up in the list
+	b := NewHueBridge(0)
+	defer b.Close()
+	b.AddUser("owner", "test#lights")
+	b.CreateLight(1)
+	b.CreateLight(2)
+	h := b.Handler()
+	serve(h, "PUT", "/api/owner/lights/1", `{"name":"Desk"}`, "")
+	serve(h, "DELETE", "/api/owner/lights/2", "", "")
+	var lights map[string]struct {
+		Name string `json:"name"`
+	}
+	rec := serve(h, "GET", "/api/owner/lights", "", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &lights); err != nil || len(lights) != 1 || lights["1"].Name != "Desk" {
+		t.Errorf("GET /lights = %s", rec.Body)
+	}
+}
+
+func TestUpdateLightStateXY(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+		xy   [2]float64
+	}{
+		{"in gamut", `{"on":true,"xy":[0.4,0.4]}`, `{"success":{"/lights/1/state/xy":[0.4,0.4]}}`, [2]float64{0.4, 0.4}},
+		{"clamped to the gamut", `{"on":true,"xy":[0.3,0.9]}`, `{"success":{"/lights/1/state/xy":[0.3,0.9]}}`, [2]float64{0.17, 0.7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#lights")
+			light, _ := b.CreateLight(1)
+			rec := serve(b.Handler(), "PUT", "/api/owner/lights/1/state", tt.body, "")
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("PUT %s = %s, want %s", tt.body, rec.Body, tt.want)
+			}
+			got := light.Snapshot()
+			if math.Abs(got.XY[0]-tt.xy[0]) > 1e-4 || math.Abs(got.XY[1]-tt.xy[1]) > 1e-4 || got.ColorMode != "xy" {
+				t.Errorf("xy = %v in mode %q, want %v in mode xy", got.XY, got.ColorMode, tt.xy)
+			}
+		})
+	}
+}
+
+func TestUpdateLightStateInc(t *testing.T) {
+	bri := func(s LightState) int { return int(s.Brightness) }
+	hue := func(s LightState) int { return int(s.Hue) }
+	sat := func(s LightState) int { return int(s.Saturation) }
+	ct := func(s LightState) int { return int(s.ColorTemp) }
+	tests := []struct {
+		name   string
+		bodies []string
+		field  func(LightState) int
+		want   int
+	}{
+		{"bri", []string{`{"on":true,"bri_inc":-54}`}, bri, 200},
+		{"bri clamped", []string{`{"on":true,"bri":100}`, `{"bri_inc":-200}`}, bri, 1},
+		{"absolute value wins", []string{`{"on":true,"bri":100,"bri_inc":-50}`}, bri, 100},
+		{"hue wraps around", []string{`{"on":true,"hue":65000}`, `{"hue_inc":1000}`}, hue, 464},
+		{"sat clamped", []string{`{"on":true,"sat":200}`, `{"sat_inc":100}`}, sat, 254},
+		{"ct clamped", []string{`{"on":true,"ct_inc":200}`}, ct, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#lights")
+			light, _ := b.CreateLight(1)
+			for _, body := range tt.bodies {
+				serve(b.Handler(), "PUT", "/api/owner/lights/1/state", body, "")
+			}
+			if got := tt.field(light.Snapshot()); got != tt.want {
+				t.Errorf("after %v got %d, want %d", tt.bodies, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// V2 API structures for CLIP API
+type V2Light struct {
+	ID               string        `json:"id"`
+	IDV1             string        `json:"id_v1"`
+	Owner            V2ResourceRef `json:"owner"`
+	Metadata         V2Metadata    `json:"metadata"`
+	On               V2OnState     `json:"on"`
+	Dimming          V2Dimming     `json:"dimming"`
+	Color            *V2Color      `json:"color,omitempty"`
+	ColorTemperature *V2CT         `json:"color_temperature,omitempty"`
+	Type             string        `json:"type"`
+}
+
+type V2Metadata struct {
+	Name      string `json:"name"`
+	Archetype string `json:"archetype"`
+}
+
+type V2OnState struct {
+	On bool `json:"on"`
+}
+
+type V2Dimming struct {
+	Brightness  float64 `json:"brightness"`
+	MinDimLevel float64 `json:"min_dim_level,omitempty"`
+}
+
+type V2Color struct {
+	XY        V2XY    `json:"xy"`
+	Gamut     V2Gamut `json:"gamut"`
+	GamutType string  `json:"gamut_type"`
+}
+
+type V2XY struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type V2CT struct {
+	Mirek       int            `json:"mirek"`
+	MirekValid  bool           `json:"mirek_valid"`
+	MirekSchema *V2MirekSchema `json:"mirek_schema,omitempty"`
+}
+
+type V2MirekSchema struct {
+	MirekMinimum int `json:"mirek_minimum"`
+	MirekMaximum int `json:"mirek_maximum"`
+}
+
+type V2Gamut struct {
+	Red   V2XY `json:"red"`
+	Green V2XY `json:"green"`
+	Blue  V2XY `json:"blue"`
+}
+
+type V2Response struct {
+	Errors []interface{} `json:"errors"`
+	Data   []V2Light     `json:"data"`
+}
+
+type V2Error struct {
+	Description string `json:"description"`
+}
+
+// writeV2Error writes a CLIP v2 error response with the given HTTP status
+func writeV2Error(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(V2Response{
+		Errors: []interface{}{V2Error{Description: description}},
+		Data:   []V2Light{},
+	})
+}
+
+// writeV2Data writes a successful CLIP v2 response holding data, a slice of
+// resources or resource references
+func writeV2Data(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Errors []interface{} `json:"errors"`
+		Data   interface{}   `json:"data"`
+	}{[]interface{}{}, data})
+}
+
+// writeV2LimitError writes the CLIP v2 error for a resource that cannot be
+// created because the bridge holds as many resources of its kind as it can
+func writeV2LimitError(w http.ResponseWriter, resourceType string, limit int) {
+	writeV2Error(w, http.StatusInsufficientStorage,
+		fmt.Sprintf("cannot create %s: the bridge holds %d at most", resourceType, limit))
+}
+
+func handleHueV2API(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	path := strings.TrimPrefix(r.URL.Path, "/clip/v2/")
+	parts := strings.Split(path, "/")
+
+	if len(parts) < 1 {
+		http.Error(w, "Invalid CLIP v2 API path", http.StatusBadRequest)
+		return
+	}
+
+	// The application key of a paired user is required
+	if !bridge.authorize(r.Header.Get("hue-application-key")) {
+		writeV2Error(w, http.StatusForbidden, "unauthorized user")
+		return
+	}
+
+	// Handle /clip/v2/resource/light
+	if len(parts) >= 2 && parts[0] == "resource" && parts[1] == "light" {
+		if r.Method == "GET" {
+			handleGetV2Lights(w, r, bridge)
+		} else if r.Method == "PUT" && len(parts) >= 3 {
+			// Handle PUT /clip/v2/resource/light/{id}
+			handleUpdateV2LightState(w, r, parts[2], bridge)
+		}
+		return
+	}
+
+	// Handle /clip/v2/resource/device
+	if len(parts) >= 2 && parts[0] == "resource" && parts[1] == "device" {
+		switch {
+		case r.Method == "GET" && len(parts) == 2:
+			handleGetV2Devices(w, r, bridge)
+		case r.Method == "GET" && len(parts) == 3:
+			handleGetV2Device(w, r, parts[2], bridge)
+		case r.Method == "PUT" && len(parts) == 3:
+			handleUpdateV2Device(w, r, parts[2], bridge)
+		default:
+			writeV2Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	// Handle /clip/v2/resource/room and /clip/v2/resource/zone
+	if len(parts) >= 2 && parts[0] == "resource" && (parts[1] == "room" || parts[1] == "zone") {
+		switch {
+		case r.Method == "GET" && len(parts) == 2:
+			handleGetV2Groups(w, r, parts[1], bridge)
+		case r.Method == "POST" && len(parts) == 2:
+			handleCreateV2Group(w, r, parts[1], bridge)
+		case r.Method == "GET" && len(parts) == 3:
+			handleGetV2Group(w, r, parts[1], parts[2], bridge)
+		case r.Method == "PUT" && len(parts) == 3:
+			handleUpdateV2Group(w, r, parts[1], parts[2], bridge)
+		case r.Method == "DELETE" && len(parts) == 3:
+			handleDeleteV2Group(w, r, parts[1], parts[2], bridge)
+		default:
+			writeV2Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	// Handle /clip/v2/resource/scene
+	if len(parts) >= 2 && parts[0] == "resource" && parts[1] == "scene" {
+		switch {
+		case r.Method == "GET" && len(parts) == 2:
+			handleGetV2Scenes(w, r, bridge)
+		case r.Method == "POST" && len(parts) == 2:
+			handleCreateV2Scene(w, r, bridge)
+		case r.Method == "GET" && len(parts) == 3:
+			handleGetV2Scene(w, r, parts[2], bridge)
+		case r.Method == "PUT" && len(parts) == 3:
+			handleUpdateV2Scene(w, r, parts[2], bridge)
+		case r.Method == "DELETE" && len(parts) == 3:
+			handleDeleteV2Scene(w, r, parts[2], bridge)
+		default:
+			writeV2Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	// Handle /clip/v2/resource/grouped_light
+	if len(parts) >= 2 && parts[0] == "resource" && parts[1] == "grouped_light" {
+		switch {
+		case r.Method == "GET" && len(parts) == 2:
+			handleGetV2GroupedLights(w, r, bridge)
+		case r.Method == "GET" && len(parts) == 3:
+			handleGetV2GroupedLight(w, r, parts[2], bridge)
+		case r.Method == "PUT" && len(parts) == 3:
+			handleUpdateV2GroupedLight(w, r, parts[2], bridge)
+		default:
+			writeV2Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	// Default response for unknown v2 endpoints
+	response := V2Response{
+		Errors: []interface{}{},
+		Data:   []V2Light{},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleGetV2Lights(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	var v2Lights []V2Light
+	for _, id := range bridge.LightIDs() {
+		light, exists := bridge.Light(id)
+		if !exists {
+			continue
+		}
+		v2Light := convertToV2Light(light)
+		v2Lights = append(v2Lights, v2Light)
+	}
+
+	response := V2Response{
+		Errors: []interface{}{},
+		Data:   v2Lights,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleUpdateV2LightState(w http.ResponseWriter, r *http.Request, lightID string, bridge *HueBridge) {
+	var update map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Find the light
+	light, exists := bridge.lightByAnyID(lightID)
+
+	if !exists {
+		http.Error(w, "Light not found", http.StatusNotFound)
+		return
+	}
+
+	// Convert v2 format to v1 format for internal processing
+	stateUpdate := convertV2ToV1StateUpdate(update, light.Capabilities)
+	bridge.lightsChanged([]*HueLight{light})
+	light.updateLightState(stateUpdate)
+
+	// Return the updated light in v2 format
+	response := V2Response{
+		Errors: []interface{}{},
+		Data:   []V2Light{convertToV2Light(light)},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	log.Printf("V2 Light %s updated via CLIP API", lightID)
+}
+
+func convertToV2Light(light *HueLight) V2Light {
+	state := light.Snapshot()
+	g, gamutType := light.gamut()
+
+	_, archetype := productForModel(light.ModelID)
+
+	v2Light := V2Light{
+		ID:    light.ID,
+		IDV1:  "/lights/" + light.v1ID,
+		Owner: V2ResourceRef{RID: light.deviceID, RType: "device"},
+		Metadata: V2Metadata{
+			Name:      light.DisplayName(),
+			Archetype: archetype,
+		},
+		On: V2OnState{
+			On: state.On,
+		},
+		Dimming: V2Dimming{
+			Brightness:  float64(state.Brightness) / 254.0 * 100.0,
+			MinDimLevel: light.Capabilities.minDimPercent(),
+		},
+		Type: "light",
+	}
+
+	// Like the bridge, report the color of color lights in every color mode,
+	// and the color temperature, only valid in ct mode, of lights having one
+	if light.Capabilities.Control.ColorGamutType != "" {
+		v2Light.Color = &V2Color{
+			XY: V2XY{X: state.XY[0], Y: state.XY[1]},
+			Gamut: V2Gamut{
+				Red:   V2XY{X: g.Red.X, Y: g.Red.Y},
+				Green: V2XY{X: g.Green.X, Y: g.Green.Y},
+				Blue:  V2XY{X: g.Blue.X, Y: g.Blue.Y},
+			},
+			GamutType: gamutType,
+		}
+	}
+	if ct := light.Capabilities.Control.CT; ct != nil {
+		v2Light.ColorTemperature = &V2CT{
+			Mirek:      int(state.ColorTemp),
+			MirekValid: state.ColorMode == "ct",
+			MirekSchema: &V2MirekSchema{
+				MirekMinimum: int(ct.Min),
+				MirekMaximum: int(ct.Max),
+			},
+		}
+	}
+
+	return v2Light
+}
+
+// convertV2ToV1StateUpdate converts a v2 light update to a v1 state update,
+// clamping values to the capabilities of the light.
+func convertV2ToV1StateUpdate(v2Update map[string]interface{}, caps LightCapabilities) StateUpdate {
+	var update StateUpdate
+
+	// Handle on/off
+	if onData, exists := v2Update["on"]; exists {
+		if onMap, ok := onData.(map[string]interface{}); ok {
+			if on, exists := onMap["on"]; exists {
+				if onBool, ok := on.(bool); ok {
+					update.On = &onBool
+				}
+			}
+		}
+	}
+
+	// Handle dimming (brightness)
+	if dimmingData, exists := v2Update["dimming"]; exists {
+		if dimmingMap, ok := dimmingData.(map[string]interface{}); ok {
+			if brightness, exists := dimmingMap["brightness"]; exists {
+				if brightnessFloat, ok := brightness.(float64); ok {
+					bri := v2BrightnessToV1(brightnessFloat, caps)
+					update.Brightness = &bri
+				}
+			}
+		}
+	}
+
+	// Handle dimming_delta (relative brightness, in percent)
+	if deltaData, exists := v2Update["dimming_delta"]; exists {
+		if deltaMap, ok := deltaData.(map[string]interface{}); ok {
+			action, _ := deltaMap["action"].(string)
+			delta, _ := deltaMap["brightness_delta"].(float64)
+			if inc, ok := v2DeltaToIncrement(action, delta/100.0*254.0); ok {
+				briInc := int16(clampInt(inc, -254, 254))
+				update.BrightnessInc = &briInc
+			}
+		}
+	}
+
+	// Handle color_temperature_delta (relative color temperature, in mirek)
+	if deltaData, exists := v2Update["color_temperature_delta"]; exists {
+		if deltaMap, ok := deltaData.(map[string]interface{}); ok {
+			action, _ := deltaMap["action"].(string)
+			delta, _ := deltaMap["mirek_delta"].(float64)
+			if inc, ok := v2DeltaToIncrement(action, delta); ok {
+				ctInc := int32(clampInt(inc, -65534, 65534))
+				update.ColorTempInc = &ctInc
+			}
+		}
+	}
+
+	// Handle dynamics (transition duration in ms)
+	if dynamicsData, exists := v2Update["dynamics"]; exists {
+		if dynamicsMap, ok := dynamicsData.(map[string]interface{}); ok {
+			if duration, exists := dynamicsMap["duration"]; exists {
+				if durationFloat, ok := duration.(float64); ok && durationFloat >= 0 {
+					// Convert from milliseconds to v1 deciseconds
+					transitionTime := uint16(math.Min(durationFloat/100.0+0.5, math.MaxUint16))
+					update.TransitionTime = &transitionTime
+				}
+			}
+		}
+	}
+
+	// Handle color
+	if colorData, exists := v2Update["color"]; exists {
+		if colorMap, ok := colorData.(map[string]interface{}); ok {
+			// Handle XY color
+			if xyData, exists := colorMap["xy"]; exists {
+				if xyMap, ok := xyData.(map[string]interface{}); ok {
+					if x, xExists := xyMap["x"]; xExists {
+						if y, yExists := xyMap["y"]; yExists {
+							if xFloat, xOk := x.(float64); xOk {
+								if yFloat, yOk := y.(float64); yOk {
+									update.XY = &[2]float64{
+										math.Max(0, math.Min(1, xFloat)),
+										math.Max(0, math.Min(1, yFloat)),
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Handle color temperature
+	if ctData, exists := v2Update["color_temperature"]; exists {
+		if ctMap, ok := ctData.(map[string]interface{}); ok {
+			if mirek, exists := ctMap["mirek"]; exists {
+				if mirekFloat, ok := mirek.(float64); ok && caps.supportsColorTemp() {
+					ct := caps.clampColorTemp(int(math.Round(math.Max(0, math.Min(math.MaxUint16, mirekFloat)))))
+					update.ColorTemp = &ct
+				}
+			}
+		}
+	}
+
+	return update
+}
+
+// v2BrightnessToV1 clamps a v2 brightness to the dimming range of the light,
+// then converts it from percentage (0-100) to Hue range (1-254)
+func v2BrightnessToV1(brightness float64, caps LightCapabilities) uint8 {
+	brightness = math.Max(caps.minDimPercent(), math.Min(100, brightness))
+	return clampBrightness(int(math.Round(brightness / 100.0 * 254.0)))
+}
+
+// v2DeltaToIncrement converts a v2 delta action ("up", "down" or "stop") to a
+// signed v1 increment. "stop" maps to 0, which stops an ongoing transition.
+func v2DeltaToIncrement(action string, delta float64) (int, bool) {
+	inc := int(math.Round(math.Abs(delta)))
+	switch action {
+	case "up":
+		return inc, inc != 0
+	case "down":
+		return -inc, inc != 0
+	case "stop":
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,719 @@
+package hue
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Recall statuses of a scene
+const (
+	sceneInactive = "inactive"
+	sceneStatic   = "static"
+	sceneDynamic  = "dynamic_palette"
+)
+
+const (
+	// defaultSceneSpeed is the speed of new scenes, halfway between the
+	// slowest and fastest palette cycling
+	defaultSceneSpeed = 0.5
+	// slowestDynamicStep and fastestDynamicStep are the time each palette
+	// color is shown at speed 0 and 1
+	slowestDynamicStep = 30 * time.Second
+	fastestDynamicStep = 2 * time.Second
+)
+
+// V2Scene is a CLIP v2 scene: the v1 group scene of a room or zone
+type V2Scene struct {
+	ID          string          `json:"id"`
+	IDV1        string          `json:"id_v1"`
+	Actions     []V2SceneAction `json:"actions"`
+	Palette     V2Palette       `json:"palette"`
+	Metadata    V2SceneMetadata `json:"metadata"`
+	Group       V2ResourceRef   `json:"group"`
+	Speed       float64         `json:"speed"`
+	AutoDynamic bool            `json:"auto_dynamic"`
+	Status      V2SceneStatus   `json:"status"`
+	Type        string          `json:"type"`
+}
+
+type V2SceneMetadata struct {
+	Name string `json:"name"`
+}
+
+type V2SceneStatus struct {
+	Active string `json:"active"`
+}
+
+// V2SceneAction is the state recalled for a light of a scene
+type V2SceneAction struct {
+	Target V2ResourceRef `json:"target"`
+	Action V2LightAction `json:"action"`
+}
+
+// V2LightAction holds the attributes of a light set by a scene
+type V2LightAction struct {
+	On               *V2OnState `json:"on,omitempty"`
+	Dimming          *V2Dimming `json:"dimming,omitempty"`
+	Color            *V2ColorXY `json:"color,omitempty"`
+	ColorTemperature *V2Mirek   `json:"color_temperature,omitempty"`
+}
+
+type V2ColorXY struct {
+	XY V2XY `json:"xy"`
+}
+
+type V2Mirek struct {
+	Mirek int `json:"mirek"`
+}
+
+// V2Palette holds the colors a dynamic scene cycles its lights through
+type V2Palette struct {
+	Color            []V2PaletteColor            `json:"color"`
+	Dimming          []V2Dimming                 `json:"dimming"`
+	ColorTemperature []V2PaletteColorTemperature `json:"color_temperature"`
+}
+
+type V2PaletteColor struct {
+	Color   V2ColorXY `json:"color"`
+	Dimming V2Dimming `json:"dimming"`
+}
+
+type V2PaletteColorTemperature struct {
+	ColorTemperature V2Mirek   `json:"color_temperature"`
+	Dimming          V2Dimming `json:"dimming"`
+}
+
+// v2ActionOf returns the v2 action of a scene light state, converting a
+// hue/sat color to xy in the gamut of the light
+func v2ActionOf(state StateUpdate, light *HueLight) V2LightAction {
+	var action V2LightAction
+	if state.On != nil {
+		action.On = &V2OnState{On: *state.On}
+	}
+	if state.Brightness != nil {
+		action.Dimming = &V2Dimming{Brightness: float64(*state.Brightness) / 254.0 * 100.0}
+	}
+	switch {
+	case state.XY != nil:
+		action.Color = &V2ColorXY{XY: V2XY{X: state.XY[0], Y: state.XY[1]}}
+	case state.ColorTemp != nil:
+		action.ColorTemperature = &V2Mirek{Mirek: int(*state.ColorTemp)}
+	case state.Hue != nil && state.Saturation != nil:
+		g, _ := light.gamut()
+		x, y := hueSatToXY(*state.Hue, *state.Saturation, g)
+		action.Color = &V2ColorXY{XY: V2XY{X: round4(x), Y: round4(y)}}
+	}
+	return action
+}
+
+// stateUpdate returns the scene light state of the action, clamped to the
+// capabilities of the light
+func (a V2LightAction) stateUpdate(caps LightCapabilities) StateUpdate {
+	var update StateUpdate
+	if a.On != nil {
+		update.On = &a.On.On
+	}
+	if a.Dimming != nil {
+		bri := v2BrightnessToV1(a.Dimming.Brightness, caps)
+		update.Brightness = &bri
+	}
+	if a.Color != nil {
+		update.XY = &[2]float64{a.Color.XY.X, a.Color.XY.Y}
+	} else if a.ColorTemperature != nil && caps.supportsColorTemp() {
+		ct := caps.clampColorTemp(a.ColorTemperature.Mirek)
+		update.ColorTemp = &ct
+	}
+	return update
+}
+
+// checkV2Color returns a description of the first invalid color or
+// brightness, if any
+func checkV2Color(name string, xy *V2XY, mirek *V2Mirek, dimming *V2Dimming) (string, bool) {
+	if xy != nil && (xy.X < 0 || xy.X > 1 || xy.Y < 0 || xy.Y > 1) {
+		return fmt.Sprintf("invalid value for %s.color.xy", name), false
+	}
+	if mirek != nil && (mirek.Mirek < 153 || mirek.Mirek > 500) {
+		return fmt.Sprintf("invalid value for %s.color_temperature.mirek", name), false
+	}
+	if dimming != nil && (dimming.Brightness < 0 || dimming.Brightness > 100) {
+		return fmt.Sprintf("invalid value for %s.dimming.brightness", name), false
+	}
+	return "", true
+}
+
+// check returns a description of the first invalid palette entry, if any.
+// Like the bridge, a palette holds up to 9 colors and a single brightness
+// and color temperature.
+func (p V2Palette) check() (string, bool) {
+	if len(p.Color) > 9 || len(p.Dimming) > 1 || len(p.ColorTemperature) > 1 {
+		return "too many palette entries", false
+	}
+	for _, c := range p.Color {
+		if description, ok := checkV2Color("palette", &c.Color.XY, nil, &c.Dimming); !ok {
+			return description, false
+		}
+	}
+	for _, d := range p.Dimming {
+		if description, ok := checkV2Color("palette", nil, nil, &d); !ok {
+			return description, false
+		}
+	}
+	for _, c := range p.ColorTemperature {
+		if description, ok := checkV2Color("palette", nil, &c.ColorTemperature, &c.Dimming); !ok {
+			return description, false
+		}
+	}
+	return "", true
+}
+
+// steps returns the states a dynamic recall cycles through: the colors of
+// the palette, or its color temperatures if it has no colors. The palette
+// brightness, if set, replaces the brightness of every entry.
+func (p V2Palette) steps() []StateUpdate {
+	var steps []StateUpdate
+	for _, c := range p.Color {
+		steps = append(steps, StateUpdate{
+			XY:         &[2]float64{c.Color.XY.X, c.Color.XY.Y},
+			Brightness: paletteBrightness(c.Dimming),
+		})
+	}
+	if len(steps) == 0 {
+		for _, c := range p.ColorTemperature {
+			ct := uint16(c.ColorTemperature.Mirek)
+			steps = append(steps, StateUpdate{ColorTemp: &ct, Brightness: paletteBrightness(c.Dimming)})
+		}
+	}
+	if len(p.Dimming) > 0 {
+		for i := range steps {
+			steps[i].Brightness = paletteBrightness(p.Dimming[0])
+		}
+	}
+	return steps
+}
+
+// paletteBrightness returns the v1 brightness of a palette entry, or nil
+// if it leaves the brightness unchanged
+func paletteBrightness(d V2Dimming) *uint8 {
+	if d.Brightness <= 0 {
+		return nil
+	}
+	bri := clampBrightness(int(d.Brightness / 100.0 * 254.0))
+	return &bri
+}
+
+// stopDynamicLocked stops the palette cycling of the scene, if any; the
+// bridge lock must be held
+func (s *Scene) stopDynamicLocked() {
+	if s.stopDynamic != nil {
+		close(s.stopDynamic)
+		s.stopDynamic = nil
+	}
+}
+
+// activateSceneLocked sets the status of a recalled scene, making the other
+// scenes of its group and the scenes sharing lights with it inactive. It
+// returns the channel stopping the palette cycling of a dynamic recall. b.mu
+// must be held.
+func (b *HueBridge) activateSceneLocked(sceneID, status string) chan struct{} {
+	scene := b.scenes[sceneID]
+	scene.stopDynamicLocked()
+	for id, other := range b.scenes {
+		if id != sceneID && other.Type == sceneTypeGroup && scene.Type == sceneTypeGroup && other.Group == scene.Group {
+			other.deactivateLocked(b)
+		}
+	}
+	b.deactivateScenesOfLocked(scene.Lights, sceneID)
+	scene.status = status
+	if status == sceneDynamic {
+		scene.stopDynamic = make(chan struct{})
+	}
+	b.publishSceneStatusLocked(scene)
+	return scene.stopDynamic
+}
+
+// deactivateScenesOfLocked makes the active scenes other than sceneID that
+// hold any of the lights with the given v1 IDs inactive, stopping their
+// palette cycling, since the lights no longer show them. b.mu must be held.
+func (b *HueBridge) deactivateScenesOfLocked(lightIDs []string, sceneID string) {
+	changed := make(map[string]bool, len(lightIDs))
+	for _, id := range lightIDs {
+		changed[id] = true
+	}
+	for id, scene := range b.scenes {
+		if id == sceneID || scene.status == sceneInactive {
+			continue
+		}
+		for _, lightID := range scene.Lights {
+			if changed[lightID] {
+				scene.deactivateLocked(b)
+				break
+			}
+		}
+	}
+}
+
+// deactivateLocked stops the palette cycling of the scene and makes it
+// inactive; b.mu must be held
+func (s *Scene) deactivateLocked(b *HueBridge) {
+	s.stopDynamicLocked()
+	if s.status != sceneInactive {
+		s.status = sceneInactive
+		b.publishSceneStatusLocked(s)
+	}
+}
+
+// lightsChanged makes the scenes of lights changed other than by a scene
+// recall inactive. It must be called before the lights are updated, so that
+// a palette cycle does not override the change.
+func (b *HueBridge) lightsChanged(lights []*HueLight) {
+	ids := make([]string, len(lights))
+	for i, light := range lights {
+		ids[i] = light.v1ID
+	}
+	b.mu.Lock()
+	b.deactivateScenesOfLocked(ids, "")
+	b.mu.Unlock()
+}
+
+// publishSceneStatusLocked publishes the status of a scene exposed in CLIP
+// v2; b.mu must be held
+func (b *HueBridge) publishSceneStatusLocked(scene *Scene) {
+	if !b.sceneInV2Locked(scene) {
+		return
+	}
+	b.events.publish(eventUpdate, map[string]interface{}{
+		"id":     scene.v2ID,
+		"type":   "scene",
+		"status": V2SceneStatus{Active: scene.status},
+	})
+}
+
+// publishSceneDeleteLocked publishes the deletion of a scene exposed in
+// CLIP v2; b.mu must be held
+func (b *HueBridge) publishSceneDeleteLocked(scene *Scene) {
+	if b.sceneInV2Locked(scene) {
+		b.events.publish(eventDelete, map[string]string{"id": scene.v2ID, "type": "scene"})
+	}
+}
+
+// dynamicStep returns how long each palette color is shown at the given
+// speed, from 0 (slowest) to 1 (fastest)
+func dynamicStep(speed float64) time.Duration {
+	return time.Duration(lerp(float64(slowestDynamicStep), float64(fastestDynamicStep), speed))
+}
+
+// cyclePalette turns the lights on and fades each of them from one palette
+// step to the next, every light starting at a different step, until stop
+// is closed. Lights turned off in the meantime are left alone.
+func cyclePalette(lights []*HueLight, steps []StateUpdate, step time.Duration, first *uint16, stop chan struct{}) {
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	on := true
+	transitionTime := uint16(step / (100 * time.Millisecond))
+	for n := 0; ; n++ {
+		for i, light := range lights {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			update := steps[(n+i)%len(steps)]
+			if n == 0 {
+				update.On, update.TransitionTime = &on, first
+			} else if !light.Snapshot().On {
+				continue
+			} else {
+				update.TransitionTime = &transitionTime
+			}
+			light.updateLightState(update)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// v2SceneRecall is the recall attribute of a scene update
+type v2SceneRecall struct {
+	Action string `json:"action"`
+	// Duration is the transition to the scene in milliseconds
+	Duration *float64   `json:"duration"`
+	Dimming  *V2Dimming `json:"dimming"`
+}
+
+// recallV2SceneLocked recalls the scene statically or cycling through its
+// palette. "active" recalls a scene with auto_dynamic set dynamically. b.mu
+// must be held; the returned function updates the lights and must be called
+// once it is released. Otherwise it returns a description of why the scene
+// cannot be recalled.
+func (b *HueBridge) recallV2SceneLocked(sceneID string, recall v2SceneRecall) (func(), string, bool) {
+	scene := b.scenes[sceneID]
+	steps := scene.palette.steps()
+	dynamic := recall.Action == sceneDynamic || (recall.Action == "active" && scene.autoDynamic && len(steps) > 0)
+	if dynamic && len(steps) == 0 {
+		return nil, "scene has no palette colors", false
+	}
+	type lightState struct {
+		light *HueLight
+		state StateUpdate
+	}
+	var lights []lightState
+	for _, id := range scene.Lights {
+		if light, exists := b.lights[id]; exists {
+			lights = append(lights, lightState{light, scene.LightStates[id]})
+		}
+	}
+	status := sceneStatic
+	if dynamic {
+		status = sceneDynamic
+	}
+	stop := b.activateSceneLocked(sceneID, status)
+	step := dynamicStep(scene.speed)
+
+	var transitionTime *uint16
+	if recall.Duration != nil {
+		tt := uint16(*recall.Duration / 100.0)
+		transitionTime = &tt
+	}
+	if dynamic {
+		members := make([]*HueLight, len(lights))
+		for i, l := range lights {
+			members[i] = l.light
+		}
+		if recall.Dimming != nil {
+			for i := range steps {
+				steps[i].Brightness = paletteBrightness(*recall.Dimming)
+			}
+		}
+		return func() { go cyclePalette(members, steps, step, transitionTime, stop) }, "", true
+	}
+	return func() {
+		for _, l := range lights {
+			state := l.state
+			state.TransitionTime = transitionTime
+			if recall.Dimming != nil {
+				bri := v2BrightnessToV1(recall.Dimming.Brightness, l.light.Capabilities)
+				state.Brightness = &bri
+			}
+			l.light.updateLightState(state)
+		}
+	}, "", true
+}
+
+// convertToV2SceneLocked returns the v2 representation of a group scene;
+// b.mu must be held
+func (b *HueBridge) convertToV2SceneLocked(id string, scene *Scene) V2Scene {
+	group := b.groups[scene.Group]
+	actions := []V2SceneAction{}
+	for _, lightID := range scene.Lights {
+		light, exists := b.lights[lightID]
+		state, stored := scene.LightStates[lightID]
+		if exists && stored {
+			actions = append(actions, V2SceneAction{
+				Target: V2ResourceRef{RID: light.ID, RType: "light"},
+				Action: v2ActionOf(state, light),
+			})
+		}
+	}
+	palette := scene.palette
+	if palette.Color == nil {
+		palette.Color = []V2PaletteColor{}
+	}
+	if palette.Dimming == nil {
+		palette.Dimming = []V2Dimming{}
+	}
+	if palette.ColorTemperature == nil {
+		palette.ColorTemperature = []V2PaletteColorTemperature{}
+	}
+	return V2Scene{
+		ID:          scene.v2ID,
+		IDV1:        "/scenes/" + id,
+		Actions:     actions,
+		Palette:     palette,
+		Metadata:    V2SceneMetadata{Name: scene.Name},
+		Group:       V2ResourceRef{RID: group.v2ID, RType: v2GroupTypes[group.Type]},
+		Speed:       scene.speed,
+		AutoDynamic: scene.autoDynamic,
+		Status:      V2SceneStatus{Active: scene.status},
+		Type:        "scene",
+	}
+}
+
+// v2SceneIDsLocked returns the v1 IDs of the scenes exposed in CLIP v2,
+// those of rooms and zones, in order; b.mu must be held
+func (b *HueBridge) v2SceneIDsLocked() []string {
+	var ids []string
+	for id, scene := range b.scenes {
+		if b.sceneInV2Locked(scene) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// sceneInV2Locked reports whether the scene is exposed in CLIP v2, as the
+// scene of a room or zone; b.mu must be held
+func (b *HueBridge) sceneInV2Locked(scene *Scene) bool {
+	group, exists := b.groups[scene.Group]
+	return exists && scene.Type == sceneTypeGroup && v2GroupTypes[group.Type] != ""
+}
+
+// sceneByV2IDLocked finds a scene exposed in CLIP v2 by its v2 ID; b.mu
+// must be held
+func (b *HueBridge) sceneByV2IDLocked(v2ID string) (string, *Scene, bool) {
+	for _, id := range b.v2SceneIDsLocked() {
+		if scene := b.scenes[id]; scene.v2ID == v2ID {
+			return id, scene, true
+		}
+	}
+	return "", nil, false
+}
+
+// v2SceneBody is the body of POST and PUT requests on scenes
+type v2SceneBody struct {
+	Metadata *struct {
+		Name *string `json:"name"`
+	} `json:"metadata"`
+	Group       *V2ResourceRef   `json:"group"`
+	Actions     *[]V2SceneAction `json:"actions"`
+	Palette     *V2Palette       `json:"palette"`
+	Speed       *float64         `json:"speed"`
+	AutoDynamic *bool            `json:"auto_dynamic"`
+	Recall      *v2SceneRecall   `json:"recall"`
+}
+
+// applyLocked applies the body to a scene whose group is already set. The
+// actions replace the lights of the scene, which must belong to its group.
+// It returns a description of the first invalid attribute. b.mu must be
+// held.
+func (body v2SceneBody) applyLocked(b *HueBridge, scene *Scene) (string, bool) {
+	if body.Metadata != nil && body.Metadata.Name != nil {
+		name := *body.Metadata.Name
+		if name == "" || len(name) > 32 {
+			return "invalid value for metadata.name", false
+		}
+		scene.Name = name
+	}
+	if body.Palette != nil {
+		if description, ok := body.Palette.check(); !ok {
+			return description, false
+		}
+		scene.palette = *body.Palette
+	}
+	if body.Speed != nil {
+		if *body.Speed < 0 || *body.Speed > 1 {
+			return "invalid value for speed", false
+		}
+		scene.speed = *body.Speed
+	}
+	if body.AutoDynamic != nil {
+		scene.autoDynamic = *body.AutoDynamic
+	}
+	if body.Actions == nil {
+		return "", true
+	}
+
+	group := b.groups[scene.Group]
+	lights := []string{}
+	states := make(map[string]StateUpdate, len(*body.Actions))
+	for _, action := range *body.Actions {
+		light, exists := b.lightByAnyIDLocked(action.Target.RID)
+		if !exists || action.Target.RType != "light" || !containsLight(group, light.v1ID) {
+			return fmt.Sprintf("invalid target %s %s", action.Target.RType, action.Target.RID), false
+		}
+		if _, duplicate := states[light.v1ID]; duplicate {
+			return fmt.Sprintf("duplicate target light %s", action.Target.RID), false
+		}
+		var xy *V2XY
+		if action.Action.Color != nil {
+			xy = &action.Action.Color.XY
+		}
+		if description, ok := checkV2Color("action", xy, action.Action.ColorTemperature, action.Action.Dimming); !ok {
+			return description, false
+		}
+		lights = append(lights, light.v1ID)
+		states[light.v1ID] = action.Action.stateUpdate(light.Capabilities)
+	}
+	scene.Lights = lights
+	scene.LightStates = states
+	return "", true
+}
+
+func handleGetV2Scenes(w http.ResponseWriter, _ *http.Request, bridge *HueBridge) {
+	bridge.mu.RLock()
+	scenes := []V2Scene{}
+	for _, id := range bridge.v2SceneIDsLocked() {
+		scenes = append(scenes, bridge.convertToV2SceneLocked(id, bridge.scenes[id]))
+	}
+	bridge.mu.RUnlock()
+	writeV2Data(w, scenes)
+}
+
+func handleGetV2Scene(w http.ResponseWriter, _ *http.Request, v2ID string, bridge *HueBridge) {
+	bridge.mu.RLock()
+	id, scene, exists := bridge.sceneByV2IDLocked(v2ID)
+	var v V2Scene
+	if exists {
+		v = bridge.convertToV2SceneLocked(id, scene)
+	}
+	bridge.mu.RUnlock()
+
+	if !exists {
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeV2Data(w, []V2Scene{v})
+}
+
+// handleCreateV2Scene handles POST /clip/v2/resource/scene, which creates a
+// v1 group scene of a room or zone
+func handleCreateV2Scene(w http.ResponseWriter, r *http.Request, bridge *HueBridge) {
+	var body v2SceneBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeV2Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if body.Metadata == nil || body.Metadata.Name == nil || body.Group == nil || body.Actions == nil {
+		writeV2Error(w, http.StatusBadRequest, "metadata.name, group and actions are required")
+		return
+	}
+	if body.Recall != nil {
+		writeV2Error(w, http.StatusBadRequest, "recall cannot be set on creation")
+		return
+	}
+
+	bridge.mu.Lock()
+	if len(bridge.scenes) >= bridge.limits.Scenes {
+		bridge.mu.Unlock()
+		writeV2LimitError(w, "scene", bridge.limits.Scenes)
+		return
+	}
+	groupID, _, exists := bridge.groupByV2IDLocked(body.Group.RType, body.Group.RID)
+	if !exists {
+		bridge.mu.Unlock()
+		writeV2Error(w, http.StatusBadRequest, fmt.Sprintf("invalid group %s %s", body.Group.RType, body.Group.RID))
+		return
+	}
+	scene := newScene(sceneTypeGroup, r.Header.Get("hue-application-key"))
+	scene.Group = groupID
+	if description, ok := body.applyLocked(bridge, scene); !ok {
+		bridge.mu.Unlock()
+		writeV2Error(w, http.StatusBadRequest, description)
+		return
+	}
+	if bridge.lightStatesLocked()+len(scene.Lights) > bridge.limits.LightStates {
+		bridge.mu.Unlock()
+		writeV2LimitError(w, "scene light state", bridge.limits.LightStates)
+		return
+	}
+	id := newSceneID()
+	scene.LastUpdated = bridge.Now().UTC().Format(timeLayout)
+	bridge.scenes[id] = scene
+	bridge.events.publish(eventAdd, bridge.convertToV2SceneLocked(id, scene))
+	bridge.mu.Unlock()
+
+	writeV2Data(w, []V2ResourceRef{{RID: scene.v2ID, RType: "scene"}})
+
+	log.Printf("V2 Scene %s created as scene %s: %q with lights %v", scene.v2ID, id, scene.Name, scene.Lights)
+}
+
+// handleUpdateV2Scene handles PUT /clip/v2/resource/scene/{id}, which
+// changes the scene, then recalls it if recall is set
+func handleUpdateV2Scene(w http.ResponseWriter, r *http.Request, v2ID string, bridge *HueBridge) {
+	var body v2SceneBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeV2Error(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if body.Group != nil {
+		writeV2Error(w, http.StatusBadRequest, "group cannot be changed")
+		return
+	}
+	if body.Recall != nil {
+		switch body.Recall.Action {
+		case "active", sceneStatic, sceneDynamic:
+		default:
+			writeV2Error(w, http.StatusBadRequest, "invalid value for recall.action")
+			return
+		}
+		if d := body.Recall.Duration; d != nil && (*d < 0 || *d > math.MaxUint16*100) {
+			writeV2Error(w, http.StatusBadRequest, "invalid value for recall.duration")
+			return
+		}
+		if description, ok := checkV2Color("recall", nil, nil, body.Recall.Dimming); !ok {
+			writeV2Error(w, http.StatusBadRequest, description)
+			return
+		}
+	}
+
+	bridge.mu.Lock()
+	id, scene, exists := bridge.sceneByV2IDLocked(v2ID)
+	if !exists {
+		bridge.mu.Unlock()
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	// Apply to a copy so that an invalid attribute changes nothing
+	updated := *scene
+	if description, ok := body.applyLocked(bridge, &updated); !ok {
+		bridge.mu.Unlock()
+		writeV2Error(w, http.StatusBadRequest, description)
+		return
+	}
+	if bridge.lightStatesLocked()-len(scene.Lights)+len(updated.Lights) > bridge.limits.LightStates {
+		bridge.mu.Unlock()
+		writeV2LimitError(w, "scene light state", bridge.limits.LightStates)
+		return
+	}
+	updated.LastUpdated = bridge.Now().UTC().Format(timeLayout)
+	*scene = updated
+	if body.Recall == nil && (body.Actions != nil || body.Palette != nil || body.Speed != nil) {
+		// The lights no longer show the scene as it is
+		scene.deactivateLocked(bridge)
+	}
+	bridge.events.publish(eventUpdate, bridge.convertToV2SceneLocked(id, scene))
+	recall := func() {}
+	if body.Recall != nil {
+		apply, description, ok := bridge.recallV2SceneLocked(id, *body.Recall)
+		if !ok {
+			bridge.mu.Unlock()
+			writeV2Error(w, http.StatusBadRequest, description)
+			return
+		}
+		recall = apply
+	}
+	bridge.mu.Unlock()
+	recall()
+
+	writeV2Data(w, []V2ResourceRef{{RID: v2ID, RType: "scene"}})
+
+	log.Printf("V2 Scene %s updated via CLIP API", v2ID)
+}
+
+func handleDeleteV2Scene(w http.ResponseWriter, _ *http.Request, v2ID string, bridge *HueBridge) {
+	bridge.mu.Lock()
+	id, _, exists := bridge.sceneByV2IDLocked(v2ID)
+	locked := exists && bridge.sceneInUseLocked(id)
+	if exists && !locked {
+		bridge.deleteResourceLocked("/scenes/" + id)
+	}
+	bridge.mu.Unlock()
+
+	switch {
+	case !exists:
+		writeV2Error(w, http.StatusNotFound, "Not Found")
+	case locked:
+		writeV2Error(w, http.StatusConflict, "scene is used by a schedule or rule")
+	default:
+		writeV2Data(w, []V2ResourceRef{{RID: v2ID, RType: "scene"}})
+		log.Printf("V2 Scene %s deleted", v2ID)
+	}
+}
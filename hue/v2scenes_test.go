@@ -0,0 +1,216 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaletteCheck(t *testing.T) {
+	color := `{"color":{"xy":{"x":0.5,"y":0.4}},"dimming":{"brightness":50}}`
+	tests := []struct {
+		name    string
+		palette string
+		want    string
+	}{
+		{"empty", `{}`, ""},
+		{"colors", `{"color":[` + color + `,` + color + `]}`, ""},
+		{"full", `{"color":[` + color + `],"dimming":[{"brightness":80}],` +
+			`"color_temperature":[{"color_temperature":{"mirek":300},"dimming":{"brightness":20}}]}`, ""},
+		{"ten colors", `{"color":[` + strings.Repeat(color+`,`, 9) + color + `]}`, "too many palette entries"},
+		{"two brightnesses", `{"dimming":[{"brightness":10},{"brightness":20}]}`, "too many palette entries"},
+		{"two color temperatures", `{"color_temperature":[{"color_temperature":{"mirek":300}},{"color_temperature":{"mirek":400}}]}`, "too many palette entries"},
+		{"xy out of range", `{"color":[{"color":{"xy":{"x":1.5,"y":0.4}}}]}`, "invalid value for palette.color.xy"},
+		{"color brightness out of range", `{"color":[{"color":{"xy":{"x":0.5,"y":0.4}},"dimming":{"brightness":101}}]}`, "invalid value for palette.dimming.brightness"},
+		{"brightness out of range", `{"dimming":[{"brightness":-1}]}`, "invalid value for palette.dimming.brightness"},
+		{"mirek out of range", `{"color_temperature":[{"color_temperature":{"mirek":100}}]}`, "invalid value for palette.color_temperature.mirek"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p V2Palette
+			if err := json.Unmarshal([]byte(tt.palette), &p); err != nil {
+				t.Fatal(err)
+			}
+			description, ok := p.check()
+			if ok != (tt.want == "") || description != tt.want {
+				t.Errorf("check() = %q, %v, want %q", description, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaletteSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		palette string
+		want    string
+	}{
+		{"colors", `{"color":[{"color":{"xy":{"x":0.5,"y":0.4}},"dimming":{"brightness":100}},{"color":{"xy":{"x":0.2,"y":0.3}}}],` +
+			`"color_temperature":[{"color_temperature":{"mirek":300}}]}`,
+			`[{"bri":254,"xy":[0.5,0.4]},{"xy":[0.2,0.3]}]`},
+		{"color temperatures without colors", `{"color_temperature":[{"color_temperature":{"mirek":300}}]}`, `[{"ct":300}]`},
+		{"palette brightness", `{"color":[{"color":{"xy":{"x":0.5,"y":0.4}},"dimming":{"brightness":100}}],"dimming":[{"brightness":50}]}`,
+			`[{"bri":127,"xy":[0.5,0.4]}]`},
+		{"empty", `{}`, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p V2Palette
+			if err := json.Unmarshal([]byte(tt.palette), &p); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(p.steps())
+			if string(got) != tt.want {
+				t.Errorf("steps() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestV2SceneRecall(t *testing.T) {
+	tests := []struct {
+		name   string
+		scene  string
+		recall string
+		status int
+		want   string
+	}{
+		{"static", `{}`, `{"action":"static","duration":2000}`, http.StatusOK, ""},
+		{"longest duration", `{}`, `{"action":"active","duration":6553500}`, http.StatusOK, ""},
+		{"duration too long", `{}`, `{"action":"static","duration":6553600}`, http.StatusBadRequest, "invalid value for recall.duration"},
+		{"negative duration", `{}`, `{"action":"static","duration":-1}`, http.StatusBadRequest, "invalid value for recall.duration"},
+		{"unknown action", `{}`, `{"action":"blink"}`, http.StatusBadRequest, "invalid value for recall.action"},
+		{"dynamic without palette", `{}`, `{"action":"dynamic_palette"}`, http.StatusBadRequest, "scene has no palette colors"},
+		{"dynamic", `{"palette":{"color":[{"color":{"xy":{"x":0.5,"y":0.4}}}]}}`, `{"action":"dynamic_palette"}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#scenes")
+			b.CreateLight(1)
+			h := b.Handler()
+			serve(h, "POST", "/api/owner/groups", `{"name":"Room","type":"Room","lights":["1"]}`, "")
+			b.mu.RLock()
+			room := b.groups["1"].v2ID
+			b.mu.RUnlock()
+
+			body := `{"metadata":{"name":"Scene"},"group":{"rid":"` + room + `","rtype":"room"},` +
+				`"actions":[{"target":{"rid":"1","rtype":"light"},"action":{"on":{"on":true}}}]}`
+			rec := serve(h, "POST", "/clip/v2/resource/scene", body, "owner")
+			var created struct {
+				Data []V2ResourceRef `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || len(created.Data) != 1 {
+				t.Fatalf("creating the scene: %d %s", rec.Code, rec.Body)
+			}
+			path := "/clip/v2/resource/scene/" + created.Data[0].RID
+			if rec := serve(h, "PUT", path, tt.scene, "owner"); rec.Code != http.StatusOK {
+				t.Fatalf("updating the scene: %d %s", rec.Code, rec.Body)
+			}
+
+			rec = serve(h, "PUT", path, `{"recall":`+tt.recall+`}`, "owner")
+			if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("recall = %d %s, want %d with %q", rec.Code, rec.Body, tt.status, tt.want)
+			}
+			// Dynamic recalls turn the lights on in the background
+			light, _ := b.Light("1")
+			deadline := time.Now().Add(time.Second)
+			for !light.Snapshot().On && tt.status == http.StatusOK && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if on := light.Snapshot().On; on != (tt.status == http.StatusOK) {
+				t.Errorf("light on = %v after the recall", on)
+			}
+		})
+	}
+}
+
+func TestSceneDeactivation(t *testing.T) {
+	tests := []struct {
+		name   string
+		recall string
+		// method, path and body change the lights or the scene; "{zone
+		// scene}", "{scene}" and "{grouped light}" in them stand for the v1
+		// ID of the zone scene, the v2 ID of the room scene and the v2 ID of
+		// the grouped light of the room
+		method, path, body string
+		want               string
+	}{
+		{"light state", sceneDynamic, "PUT", "/api/owner/lights/1/state", `{"on":true,"bri":10}`, sceneInactive},
+		{"light state on a static scene", sceneStatic, "PUT", "/api/owner/lights/1/state", `{"on":true,"bri":10}`, sceneInactive},
+		{"other light", sceneDynamic, "PUT", "/api/owner/lights/3/state", `{"on":true}`, sceneDynamic},
+		{"v2 light", sceneDynamic, "PUT", "/clip/v2/resource/light/2", `{"on":{"on":false}}`, sceneInactive},
+		{"group action", sceneDynamic, "PUT", "/api/owner/groups/2/action", `{"on":true}`, sceneInactive},
+		{"grouped light", sceneStatic, "PUT", "/clip/v2/resource/grouped_light/{grouped light}", `{"on":{"on":true}}`, sceneInactive},
+		{"scene of another group", sceneDynamic, "PUT", "/api/owner/groups/2/action", `{"scene":"{zone scene}"}`, sceneInactive},
+		{"palette", sceneDynamic, "PUT", "/clip/v2/resource/scene/{scene}", `{"speed":0.2}`, sceneInactive},
+		{"actions", sceneStatic, "PUT", "/clip/v2/resource/scene/{scene}",
+			`{"actions":[{"target":{"rid":"1","rtype":"light"},"action":{"on":{"on":false}}}]}`, sceneInactive},
+		{"name", sceneDynamic, "PUT", "/clip/v2/resource/scene/{scene}", `{"metadata":{"name":"Renamed"}}`, sceneDynamic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewHueBridge(0)
+			defer b.Close()
+			b.AddUser("owner", "test#scenes")
+			for id := 1; id <= 3; id++ {
+				b.CreateLight(id)
+			}
+			h := b.Handler()
+			serve(h, "POST", "/api/owner/groups", `{"name":"Room","type":"Room","lights":["1","2"]}`, "")
+			serve(h, "POST", "/api/owner/groups", `{"name":"Zone","type":"Zone","lights":["1"]}`, "")
+			b.mu.RLock()
+			room, zone, groupedLight := b.groups["1"].v2ID, b.groups["2"].v2ID, b.groups["1"].groupedLightID
+			b.mu.RUnlock()
+
+			createScene := func(group, rtype, lights string) (string, string) {
+				body := `{"metadata":{"name":"Scene"},"group":{"rid":"` + group + `","rtype":"` + rtype + `"},"actions":[`
+				for i, id := range strings.Split(lights, ",") {
+					if i > 0 {
+						body += ","
+					}
+					body += `{"target":{"rid":"` + id + `","rtype":"light"},"action":{"on":{"on":true}}}`
+				}
+				body += `],"palette":{"color":[{"color":{"xy":{"x":0.5,"y":0.4}}}]}}`
+				rec := serve(h, "POST", "/clip/v2/resource/scene", body, "owner")
+				var created struct {
+					Data []V2ResourceRef `json:"data"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || len(created.Data) != 1 {
+					t.Fatalf("creating the scene: %d %s", rec.Code, rec.Body)
+				}
+				b.mu.RLock()
+				id, _, _ := b.sceneByV2IDLocked(created.Data[0].RID)
+				b.mu.RUnlock()
+				return id, created.Data[0].RID
+			}
+			sceneID, sceneV2ID := createScene(room, "room", "1,2")
+			zoneSceneID, _ := createScene(zone, "zone", "1")
+
+			rec := serve(h, "PUT", "/clip/v2/resource/scene/"+sceneV2ID, `{"recall":{"action":"`+tt.recall+`"}}`, "owner")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("recall = %d %s", rec.Code, rec.Body)
+			}
+			path := strings.NewReplacer("{scene}", sceneV2ID, "{grouped light}", groupedLight).Replace(tt.path)
+			body := strings.ReplaceAll(tt.body, "{zone scene}", zoneSceneID)
+			key := ""
+			if strings.HasPrefix(path, "/clip/") {
+				key = "owner"
+			}
+			if rec := serve(h, tt.method, path, body, key); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"error":`) {
+				t.Fatalf("%s %s = %d %s", tt.method, path, rec.Code, rec.Body)
+			}
+
+			b.mu.RLock()
+			scene := b.scenes[sceneID]
+			status, cycling := scene.status, scene.stopDynamic != nil
+			b.mu.RUnlock()
+			if status != tt.want || cycling != (tt.want == sceneDynamic) {
+				t.Errorf("status = %s, cycling %v, want %s", status, cycling, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"time"
+
+	"gioui.org/app"
+	"gioui.org/font/gofont"
+	"gioui.org/io/system"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/ilesinge/huemulator/hue"
+)
+
+// runLightWindow creates a gioui window and renders the light state as a filled background
+func runLightWindow(l *hue.HueLight, id int) {
+	// Create a window; set title to "Light #<id>". Uncomment Decorated(false) to remove OS chrome.
+	w := new(app.Window)
+	w.Option(
+		app.Title(fmt.Sprintf("Light #%d", id)),
+		// app.Decorated(false), // remove window decorations (optional)
+	)
+	// redraw the window directly on state changes, close it when the light is deleted
+	l.SetOnChange(w.Invalidate)
+	l.SetOnDelete(func() { w.Perform(system.ActionClose) })
+
+	for {
+		e := w.Event()
+		switch ev := e.(type) {
+		case app.DestroyEvent:
+			l.SetOnChange(nil)
+			l.SetOnDelete(nil)
+			return
+		case app.FrameEvent:
+			var ops op.Ops
+			gtx := app.NewContext(&ops, ev)
+
+			// Snapshot the displayed state under read lock to avoid races
+			s, animating := l.Rendered()
+
+			// Compute current color from state
+			var col color.NRGBA
+			if s.On {
+				r, g, b := s.RGB()
+				col = color.NRGBA{R: r, G: g, B: b, A: 255}
+			} else {
+				col = color.NRGBA{R: 30, G: 30, B: 30, A: 255}
+			}
+
+			paint.Fill(gtx.Ops, col)
+			if animating {
+				// Keep drawing frames until the transition completes
+				gtx.Execute(op.InvalidateCmd{})
+			}
+			ev.Frame(gtx.Ops)
+		}
+	}
+}
+
+// runBridgeWindow creates a gioui window with the virtual link button of the bridge
+func runBridgeWindow(bridge *hue.HueBridge) {
+	w := new(app.Window)
+	w.Option(
+		app.Title("Hue Bridge"),
+		app.Size(unit.Dp(280), unit.Dp(170)),
+	)
+
+	th := material.NewTheme()
+	th.Shaper = text.NewShaper(text.WithCollection(gofont.Collection()))
+	var linkButton, newLightButton widget.Clickable
+
+	for {
+		e := w.Event()
+		switch ev := e.(type) {
+		case app.DestroyEvent:
+			return
+		case app.FrameEvent:
+			var ops op.Ops
+			gtx := app.NewContext(&ops, ev)
+
+			if linkButton.Clicked(gtx) {
+				bridge.PressLinkButton()
+			}
+			if newLightButton.Clicked(gtx) {
+				if _, err := bridge.QueueLight(); err != nil {
+					log.Printf("Light not queued: %v", err)
+				}
+			}
+
+			label := "Press link button"
+			if remaining := bridge.LinkButtonRemaining(); remaining > 0 {
+				label = fmt.Sprintf("Pairing allowed (%ds)", int(remaining.Round(time.Second).Seconds()))
+				// Refresh the countdown every second
+				gtx.Execute(op.InvalidateCmd{At: gtx.Now.Add(time.Second)})
+			}
+
+			newLightLabel := "Add undiscovered light"
+			if pending := bridge.UndiscoveredLights(); pending > 0 {
+				newLightLabel = fmt.Sprintf("Add undiscovered light (%d queued)", pending)
+				// Refresh once a search finds the queued lights
+				gtx.Execute(op.InvalidateCmd{At: gtx.Now.Add(time.Second)})
+			}
+
+			layout.UniformInset(unit.Dp(16)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+					layout.Rigid(material.Button(th, &linkButton, label).Layout),
+					layout.Rigid(layout.Spacer{Height: unit.Dp(8)}.Layout),
+					layout.Rigid(material.Button(th, &newLightButton, newLightLabel).Layout),
+				)
+			})
+			ev.Frame(gtx.Ops)
+		}
+	}
+}